@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pink-tools/pink-orchestrator/internal/api"
+	"github.com/pink-tools/pink-orchestrator/internal/profile"
+	"github.com/pink-tools/pink-orchestrator/internal/services"
+	"golang.org/x/term"
+)
+
+// runApply converges the machine to a profile file after showing the plan:
+// pink-orchestrator apply <profile.yaml> [--yes] [--dry-run]. On a terminal
+// the plan must be confirmed unless --yes is given; --dry-run lists the
+// steps applying would take instead.
+func runApply(args []string) error {
+	path := ""
+	yes, dryRun := false, false
+	for _, arg := range args {
+		switch arg {
+		case "--yes", "-y":
+			yes = true
+		case "--dry-run":
+			dryRun = true
+		default:
+			path = arg
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("usage: pink-orchestrator apply <profile.yaml> [--yes] [--dry-run]")
+	}
+
+	p, err := profile.Load(path)
+	if err != nil {
+		return err
+	}
+	req := api.ApplyRequest{Profile: *p}
+
+	var planned api.ApplyResponse
+	if err := api.Call("plan", req, &planned); err != nil {
+		return err
+	}
+	if len(planned.Plan.Changes) == 0 {
+		fmt.Println("Nothing to do, the machine matches the profile")
+		return nil
+	}
+	printPlan(planned.Plan)
+
+	if dryRun {
+		req.DryRun = true
+		var walked api.ApplyResponse
+		if err := api.Call("apply", req, &walked); err != nil {
+			return err
+		}
+		fmt.Println()
+		for _, msg := range walked.Log {
+			fmt.Println(msg)
+		}
+		if walked.Error != "" {
+			return fmt.Errorf("%s", walked.Error)
+		}
+		fmt.Println("Dry run, nothing was changed")
+		return nil
+	}
+
+	if !yes && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Print("\nApply these changes? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return fmt.Errorf("cancelled")
+		}
+	}
+	fmt.Println()
+
+	var applied api.ApplyResponse
+	if err := api.Call("apply", req, &applied); err != nil {
+		return err
+	}
+	for _, msg := range applied.Log {
+		fmt.Println(msg)
+	}
+	if applied.Error != "" {
+		return fmt.Errorf("%s", applied.Error)
+	}
+	fmt.Printf("Applied %d changes\n", len(applied.Plan.Changes))
+	return nil
+}
+
+// printPlan lists changes under the service they belong to.
+func printPlan(plan services.Plan) {
+	current := ""
+	for _, c := range plan.Changes {
+		if c.Service != current {
+			current = c.Service
+			if current == services.GlobalEnv {
+				fmt.Println("global.env")
+			} else {
+				fmt.Println(current)
+			}
+		}
+		fmt.Printf("  %s\n", c)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pink-tools/pink-orchestrator/internal/api"
+)
+
+func printEnvUsage() {
+	fmt.Println(`Usage: pink-orchestrator env <service> <command> [options]
+
+Commands:
+  list                       Show variables (secrets masked)
+  get <KEY>                  Print a variable's value
+  set <KEY=VALUE>...         Set variables
+  unset <KEY>...             Remove variables
+  edit                       Edit .env in $EDITOR
+  resolve                    Show the full environment the service gets, with the source of each variable
+
+Use "global" as the service to manage variables shared by all services.
+Precedence, lowest first: system < global < service .env < start overrides.
+
+Options:
+  --restart                  Restart the service after a change if it is running
+  --show-secrets             Show secret values unmasked`)
+}
+
+func runEnvCommand(args []string) error {
+	req := api.EnvRequest{}
+	var rest []string
+	for _, arg := range args {
+		switch arg {
+		case "--restart":
+			req.Restart = true
+		case "--show-secrets":
+			req.Reveal = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) < 2 {
+		printEnvUsage()
+		os.Exit(1)
+	}
+	req.Service, req.Action = rest[0], rest[1]
+	params := rest[2:]
+
+	switch req.Action {
+	case "list":
+		var resp api.EnvResponse
+		if err := api.Call("env", req, &resp); err != nil {
+			return err
+		}
+		for _, e := range resp.Entries {
+			if !e.Set {
+				note := "not set"
+				if e.Required {
+					note = "required, not set"
+				}
+				fmt.Printf("# %s (%s)\n", e.Key, note)
+				continue
+			}
+			fmt.Printf("%s=%s\n", e.Key, e.Value)
+		}
+		return nil
+
+	case "get":
+		if len(params) != 1 {
+			return fmt.Errorf("usage: env %s get <KEY>", req.Service)
+		}
+		req.Keys = params
+		var resp api.EnvResponse
+		if err := api.Call("env", req, &resp); err != nil {
+			return err
+		}
+		fmt.Println(resp.Entries[0].Value)
+		return nil
+
+	case "set":
+		if len(params) == 0 {
+			return fmt.Errorf("usage: env %s set <KEY=VALUE>...", req.Service)
+		}
+		req.Values = make(map[string]string)
+		for _, p := range params {
+			key, value, ok := strings.Cut(p, "=")
+			if !ok {
+				return fmt.Errorf("expected KEY=VALUE, got %q", p)
+			}
+			req.Values[key] = value
+		}
+		return sendEnvChange(req)
+
+	case "unset":
+		if len(params) == 0 {
+			return fmt.Errorf("usage: env %s unset <KEY>...", req.Service)
+		}
+		req.Keys = params
+		return sendEnvChange(req)
+
+	case "edit":
+		return editEnv(req)
+
+	case "resolve":
+		var resp api.EnvResponse
+		if err := api.Call("env", req, &resp); err != nil {
+			return err
+		}
+		for _, v := range resp.Resolved {
+			fmt.Printf("%-8s %s=%s\n", v.Source, v.Key, v.Value)
+		}
+		return nil
+
+	default:
+		printEnvUsage()
+		os.Exit(1)
+	}
+	return nil
+}
+
+func sendEnvChange(req api.EnvRequest) error {
+	var resp api.EnvResponse
+	if err := api.Call("env", req, &resp); err != nil {
+		return err
+	}
+	if resp.Restarted {
+		fmt.Printf("Saved, %s restarted\n", req.Service)
+	} else {
+		fmt.Println("Saved")
+	}
+	return nil
+}
+
+// editEnv opens the .env in the user's editor via a private temp copy and
+// sends it back, so it works over SSH and without a desktop.
+func editEnv(req api.EnvRequest) error {
+	read := req
+	read.Action = "read"
+	var resp api.EnvResponse
+	if err := api.Call("env", read, &resp); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", req.Service+"-*.env")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	tmp.WriteString(resp.Content)
+	tmp.Close()
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	// EDITOR may carry arguments, e.g. "code --wait"
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], tmpPath)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("editor failed: %w", err)
+	}
+
+	edited, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(edited, []byte(resp.Content)) {
+		os.Remove(tmpPath)
+		fmt.Println("No changes")
+		return nil
+	}
+
+	req.Action = "write"
+	req.Content = string(edited)
+	if err := sendEnvChange(req); err != nil {
+		return fmt.Errorf("%w (your edit is kept in %s)", err, tmpPath)
+	}
+	os.Remove(tmpPath)
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pink-tools/pink-orchestrator/internal/api"
+)
+
+// runEvents prints the reconciler's event log, newest first:
+// pink-orchestrator events [service] [-n N].
+func runEvents(args []string) error {
+	req := api.EventsRequest{Limit: 20}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-n":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-n needs a number")
+			}
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid event count: %s", args[i])
+			}
+			req.Limit = n
+		default:
+			req.Service = args[i]
+		}
+	}
+
+	var resp api.EventsResponse
+	if err := api.Call("events", req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Events) == 0 {
+		fmt.Println("No events")
+		return nil
+	}
+
+	for _, e := range resp.Events {
+		result := "ok"
+		if e.Error != "" {
+			result = e.Error
+		}
+		fmt.Printf("%s  %-20s %-9s %-32s %s\n", e.Time.Local().Format("2006-01-02 15:04:05"),
+			e.Service, e.Action, e.Reason, result)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pink-tools/pink-orchestrator/internal/api"
+	"github.com/pink-tools/pink-orchestrator/internal/services"
+	"golang.org/x/term"
+)
+
+// runExport writes the orchestrator's configuration to an archive:
+// pink-orchestrator export <file.tar.gz> [--plain-secrets | --no-secrets].
+// Secrets are sealed with a passphrase unless told otherwise.
+func runExport(args []string) error {
+	path := ""
+	req := api.ExportRequest{Secrets: services.SecretsEncrypt}
+	for _, arg := range args {
+		switch arg {
+		case "--plain-secrets":
+			req.Secrets = services.SecretsInclude
+		case "--no-secrets":
+			req.Secrets = services.SecretsExclude
+		default:
+			path = arg
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("usage: pink-orchestrator export <file.tar.gz> [--plain-secrets | --no-secrets]")
+	}
+	if req.Secrets == services.SecretsEncrypt {
+		p, err := readSecret("Passphrase for the archive's secrets: ")
+		if err != nil {
+			return err
+		}
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			again, err := readSecret("Repeat passphrase: ")
+			if err != nil {
+				return err
+			}
+			if again != p {
+				return fmt.Errorf("passphrases don't match")
+			}
+		}
+		req.Passphrase = p
+	}
+
+	var resp api.ExportResponse
+	if err := api.Call("export", req, &resp); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, resp.Archive, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("Exported to %s\n", path)
+	if req.Secrets == services.SecretsInclude {
+		fmt.Println("Secrets are stored in plain text: keep the archive private")
+	}
+	return nil
+}
+
+// runImport restores an archive written by export and reinstalls the
+// recorded service versions: pink-orchestrator import <file.tar.gz>.
+func runImport(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: pink-orchestrator import <file.tar.gz>")
+	}
+	archive, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	m, err := services.ReadManifest(archive)
+	if err != nil {
+		return err
+	}
+	req := api.ImportRequest{Archive: archive}
+	if m.Secrets == services.SecretsEncrypt {
+		p, err := readSecret("Passphrase for the archive's secrets: ")
+		if err != nil {
+			return err
+		}
+		req.Passphrase = p
+	}
+
+	var resp api.ImportResponse
+	if err := api.Call("import", req, &resp); err != nil {
+		return err
+	}
+	for _, msg := range resp.Log {
+		fmt.Println(msg)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("%s", resp.Error)
+	}
+	if m.Secrets == services.SecretsExclude {
+		fmt.Println("The archive has no secrets: set them with 'secret set' and 'env NAME set'")
+	}
+	fmt.Println("Imported")
+	return nil
+}
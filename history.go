@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pink-tools/pink-orchestrator/internal/api"
+	"github.com/pink-tools/pink-orchestrator/internal/services"
+)
+
+// runHistory prints the recorded starts and exits of a service, newest
+// first: pink-orchestrator history <service> [-n N] [--stderr].
+func runHistory(args []string) error {
+	req := api.HistoryRequest{Limit: 20}
+	showStderr := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-n":
+			if i+1 >= len(args) {
+				return fmt.Errorf("-n needs a number")
+			}
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid run count: %s", args[i])
+			}
+			req.Limit = n
+		case "--stderr":
+			showStderr = true
+		default:
+			req.Service = args[i]
+		}
+	}
+	if req.Service == "" {
+		return fmt.Errorf("usage: pink-orchestrator history <service> [-n N] [--stderr]")
+	}
+
+	var resp api.HistoryResponse
+	if err := api.Call("history", req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Runs) == 0 {
+		fmt.Printf("No runs recorded for %s\n", req.Service)
+		return nil
+	}
+
+	fmt.Printf("%-19s %-8s %-8s %10s  %s\n", "STARTED", "OUTCOME", "EXIT", "DURATION", "ERROR")
+	for _, run := range resp.Runs {
+		fmt.Printf("%-19s %-8s %-8s %10s  %s\n", run.Started.Local().Format("2006-01-02 15:04:05"),
+			run.Outcome, exitStatus(run), formatDuration(run.Duration), run.Error)
+		if showStderr || run.Outcome == services.ExitCrashed || run.Outcome == services.ExitFailed {
+			for _, line := range run.Stderr {
+				fmt.Printf("    | %s\n", line)
+			}
+		}
+	}
+	return nil
+}
+
+// exitStatus is the exit code or signal of a run, or "-" when unknown.
+func exitStatus(run services.RunRecord) string {
+	switch {
+	case run.Signal != "":
+		return run.Signal
+	case run.ExitCode != nil:
+		return strconv.Itoa(*run.ExitCode)
+	}
+	return "-"
+}
+
+func formatDuration(seconds float64) string {
+	if seconds < 1 {
+		return "<1s"
+	}
+	return services.FormatUptime(int64(seconds))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pink-tools/pink-orchestrator/internal/api"
+)
+
+// runInstall installs (or with update, updates) a service through the
+// running orchestrator: --service-install <name> [version] [--dry-run] or
+// --service-update <name> --dry-run.
+func runInstall(update bool, args []string) error {
+	req := api.InstallRequest{Update: update}
+	var positional []string
+	for _, arg := range args {
+		if arg == "--dry-run" {
+			req.DryRun = true
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+	switch {
+	case len(positional) == 0:
+		return fmt.Errorf("service name required")
+	case len(positional) > 2 || (update && len(positional) > 1):
+		return fmt.Errorf("unexpected argument: %s", positional[len(positional)-1])
+	}
+	req.Service = positional[0]
+	if len(positional) == 2 {
+		req.Version = positional[1]
+	}
+
+	var resp api.InstallResponse
+	if err := api.Call("install", req, &resp); err != nil {
+		return err
+	}
+	for _, msg := range resp.Log {
+		fmt.Println(msg)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("%s", resp.Error)
+	}
+	if req.DryRun {
+		fmt.Println("Dry run, nothing was changed")
+	}
+	return nil
+}
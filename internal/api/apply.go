@@ -0,0 +1,44 @@
+package api
+
+import (
+	"github.com/pink-tools/pink-orchestrator/internal/profile"
+	"github.com/pink-tools/pink-orchestrator/internal/services"
+)
+
+// ApplyRequest is the argument of the "plan" and "apply" commands.
+type ApplyRequest struct {
+	Profile profile.Profile `json:"profile"`
+	DryRun  bool            `json:"dry_run,omitempty"` // apply: only report the steps
+}
+
+// ApplyResponse is the reply to the "plan" and "apply" commands. An apply
+// that failed part way still reports its plan and progress, with Error set.
+type ApplyResponse struct {
+	Plan  services.Plan `json:"plan"`
+	Log   []string      `json:"log,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+func handleApply(cmd string, req ApplyRequest) (ApplyResponse, error) {
+	var resp ApplyResponse
+	if err := req.Profile.Validate(); err != nil {
+		return resp, err
+	}
+	if cmd == "plan" {
+		plan, err := services.PlanProfile(&req.Profile)
+		resp.Plan = plan
+		return resp, err
+	}
+	apply := services.ApplyProfile
+	if req.DryRun {
+		apply = services.ApplyProfileDryRun
+	}
+	plan, err := apply(&req.Profile, func(msg string) {
+		resp.Log = append(resp.Log, msg)
+	})
+	resp.Plan = plan
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp, nil
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"net"
 	"strings"
@@ -10,13 +11,24 @@ import (
 )
 
 func Send(command, arg string) (string, error) {
-	addr := fmt.Sprintf("127.0.0.1:%d", config.Port())
+	return SendTo(config.Port(), command, arg)
+}
+
+// SendTo sends a command to the orchestrator listening on port.
+func SendTo(port int, command, arg string) (string, error) {
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
 	conn, err := net.Dial("tcp", addr)
 	if err != nil {
-		return "", fmt.Errorf("orchestrator not running (port %d)", config.Port())
+		return "", fmt.Errorf("orchestrator not running (port %d)", port)
 	}
 	defer conn.Close()
 
+	if token := readToken(); token != "" {
+		if _, err := fmt.Fprintf(conn, "%s%s\n", authPrefix, token); err != nil {
+			return "", fmt.Errorf("send failed: %w", err)
+		}
+	}
+
 	// Send command
 	_, err = fmt.Fprintf(conn, "%s:%s\n", command, arg)
 	if err != nil {
@@ -43,3 +55,23 @@ func Send(command, arg string) (string, error) {
 
 	return msg, nil
 }
+
+// Call sends req as a JSON argument and decodes the JSON reply into resp.
+// resp may be nil for commands that only report success.
+func Call(command string, req, resp any) error {
+	arg, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	msg, err := Send(command, string(arg))
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(msg), resp); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
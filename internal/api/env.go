@@ -0,0 +1,112 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+	"github.com/pink-tools/pink-orchestrator/internal/services"
+)
+
+// StartRequest is the argument of the "start-env" command: a start with
+// variables overriding the service's env files for that run.
+type StartRequest struct {
+	Service string            `json:"service"`
+	Env     map[string]string `json:"env"`
+}
+
+// EnvRequest is the argument of the "env" command.
+type EnvRequest struct {
+	Service string            `json:"service"`
+	Action  string            `json:"action"` // list, get, set, unset, read, write, resolve
+	Keys    []string          `json:"keys,omitempty"`
+	Values  map[string]string `json:"values,omitempty"`
+	Content string            `json:"content,omitempty"`
+	Reveal  bool              `json:"reveal,omitempty"`
+	Restart bool              `json:"restart,omitempty"`
+}
+
+// EnvResponse is the reply to the "env" command.
+type EnvResponse struct {
+	Entries   []services.EnvEntry    `json:"entries,omitempty"`
+	Resolved  []services.ResolvedVar `json:"resolved,omitempty"`
+	Content   string                 `json:"content,omitempty"`
+	Restarted bool                   `json:"restarted,omitempty"`
+}
+
+func handleEnv(req EnvRequest) (EnvResponse, error) {
+	var resp EnvResponse
+	changed := false
+
+	switch req.Action {
+	case "list":
+		entries, err := services.ListEnv(req.Service, req.Reveal)
+		if err != nil {
+			return resp, err
+		}
+		resp.Entries = entries
+	case "get":
+		if len(req.Keys) != 1 {
+			return resp, fmt.Errorf("get takes one variable name")
+		}
+		entry, err := services.GetEnv(req.Service, req.Keys[0], req.Reveal)
+		if err != nil {
+			return resp, err
+		}
+		resp.Entries = []services.EnvEntry{entry}
+	case "set":
+		if err := services.SetEnv(req.Service, req.Values); err != nil {
+			return resp, err
+		}
+		changed = true
+	case "unset":
+		if err := services.UnsetEnv(req.Service, req.Keys); err != nil {
+			return resp, err
+		}
+		changed = true
+	case "read":
+		content, err := services.ReadEnvContent(req.Service)
+		if err != nil {
+			return resp, err
+		}
+		resp.Content = content
+	case "resolve":
+		vars, err := services.ResolveEnv(req.Service, req.Reveal)
+		if err != nil {
+			return resp, err
+		}
+		resp.Resolved = vars
+	case "write":
+		if err := services.WriteEnvContent(req.Service, req.Content); err != nil {
+			return resp, err
+		}
+		changed = true
+	default:
+		return resp, fmt.Errorf("unknown env action: %s", req.Action)
+	}
+
+	if !changed || !req.Restart {
+		return resp, nil
+	}
+
+	// A global change affects every running service
+	targets := []string{req.Service}
+	if req.Service == services.GlobalEnv {
+		targets = nil
+		if svcs, err := registry.ListServices(); err == nil {
+			for _, svc := range svcs {
+				targets = append(targets, svc.Name)
+			}
+		}
+	}
+	for _, name := range targets {
+		if services.GetStatus(name).Status != services.StatusRunning {
+			continue
+		}
+		if err := services.Restart(name); err != nil {
+			return resp, fmt.Errorf("saved, but restarting %s failed: %w", name, err)
+		}
+		resp.Restarted = true
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,14 @@
+package api
+
+import "github.com/pink-tools/pink-orchestrator/internal/services"
+
+// EventsRequest is the argument of the "events" command.
+type EventsRequest struct {
+	Service string `json:"service,omitempty"` // empty for every service
+	Limit   int    `json:"limit,omitempty"`
+}
+
+// EventsResponse is the reply to the "events" command, newest event first.
+type EventsResponse struct {
+	Events []services.Event `json:"events"`
+}
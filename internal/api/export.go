@@ -0,0 +1,48 @@
+package api
+
+import (
+	"github.com/pink-tools/pink-orchestrator/internal/services"
+)
+
+// ExportRequest is the argument of the "export" command.
+type ExportRequest struct {
+	Secrets    string `json:"secrets,omitempty"` // services.SecretsEncrypt (default), SecretsInclude or SecretsExclude
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+// ExportResponse is the reply to the "export" command.
+type ExportResponse struct {
+	Archive []byte `json:"archive"` // tar.gz
+}
+
+// ImportRequest is the argument of the "import" command.
+type ImportRequest struct {
+	Archive    []byte `json:"archive"`
+	Passphrase string `json:"passphrase,omitempty"` // opens encrypted secrets
+}
+
+// ImportResponse is the reply to the "import" command. An import that
+// failed part way still reports its progress, with Error set.
+type ImportResponse struct {
+	Log   []string `json:"log,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+func handleExport(req ExportRequest) (ExportResponse, error) {
+	if req.Secrets == "" {
+		req.Secrets = services.SecretsEncrypt
+	}
+	archive, err := services.Export(req.Secrets, req.Passphrase)
+	return ExportResponse{Archive: archive}, err
+}
+
+func handleImport(req ImportRequest) ImportResponse {
+	var resp ImportResponse
+	err := services.Import(req.Archive, req.Passphrase, func(msg string) {
+		resp.Log = append(resp.Log, msg)
+	})
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
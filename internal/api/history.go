@@ -0,0 +1,14 @@
+package api
+
+import "github.com/pink-tools/pink-orchestrator/internal/services"
+
+// HistoryRequest is the argument of the "history" command.
+type HistoryRequest struct {
+	Service string `json:"service"`
+	Limit   int    `json:"limit,omitempty"` // 0 returns every recorded run
+}
+
+// HistoryResponse is the reply to the "history" command, newest run first.
+type HistoryResponse struct {
+	Runs []services.RunRecord `json:"runs"`
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/pink-tools/pink-orchestrator/internal/services"
+)
+
+// InstallRequest is the argument of the "install" command. With Update it
+// updates an installed service to the latest release instead.
+type InstallRequest struct {
+	Service string `json:"service"`
+	Version string `json:"version,omitempty"` // release tag; empty for the latest
+	Update  bool   `json:"update,omitempty"`
+	DryRun  bool   `json:"dry_run,omitempty"`
+}
+
+// InstallResponse is the reply to the "install" command. An install that
+// failed part way still reports its progress, with Error set.
+type InstallResponse struct {
+	Log   []string `json:"log"`
+	Error string   `json:"error,omitempty"`
+}
+
+func handleInstall(req InstallRequest) (InstallResponse, error) {
+	var resp InstallResponse
+	progress := func(msg string) {
+		resp.Log = append(resp.Log, msg)
+	}
+
+	var err error
+	switch {
+	case req.Update && req.Version != "":
+		return resp, fmt.Errorf("an update always goes to the latest release")
+	case req.Update && req.DryRun:
+		err = services.UpdateDryRun(req.Service, progress)
+	case req.Update:
+		err = services.Update(req.Service, progress)
+	case req.DryRun:
+		err = services.InstallDryRun(req.Service, req.Version, progress)
+	default:
+		err = services.InstallVersion(req.Service, req.Version, progress)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp, nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/pink-tools/pink-orchestrator/internal/secrets"
+)
+
+// SecretRequest is the argument of the "secret" command.
+type SecretRequest struct {
+	Action     string  `json:"action"` // list, set, delete, rotate, unlock
+	Name       string  `json:"name,omitempty"`
+	Value      string  `json:"value,omitempty"`
+	Passphrase *string `json:"passphrase,omitempty"`
+}
+
+// SecretResponse is the reply to the "secret" command. Values are never returned.
+type SecretResponse struct {
+	Names []string `json:"names,omitempty"`
+}
+
+func handleSecret(req SecretRequest) (SecretResponse, error) {
+	var resp SecretResponse
+
+	switch req.Action {
+	case "list":
+		names, err := secrets.List()
+		if err != nil {
+			return resp, err
+		}
+		resp.Names = names
+	case "set":
+		return resp, secrets.Set(req.Name, req.Value)
+	case "delete":
+		return resp, secrets.Delete(req.Name)
+	case "rotate":
+		return resp, secrets.Rotate(req.Passphrase)
+	case "unlock":
+		if req.Passphrase == nil {
+			return resp, fmt.Errorf("passphrase required")
+		}
+		return resp, secrets.Unlock(*req.Passphrase)
+	default:
+		return resp, fmt.Errorf("unknown secret action: %s", req.Action)
+	}
+
+	return resp, nil
+}
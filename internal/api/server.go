@@ -2,9 +2,11 @@ package api
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 
 	"github.com/pink-tools/pink-orchestrator/internal/config"
 	"github.com/pink-tools/pink-orchestrator/internal/services"
@@ -12,6 +14,20 @@ import (
 
 type Server struct {
 	listener net.Listener
+	token    string
+}
+
+var (
+	shutdownMu sync.Mutex
+	onShutdown func()
+)
+
+// SetShutdownCallback registers the function that quits the orchestrator
+// when another instance asks it to with the "shutdown" command.
+func SetShutdownCallback(cb func()) {
+	shutdownMu.Lock()
+	onShutdown = cb
+	shutdownMu.Unlock()
 }
 
 func NewServer() (*Server, error) {
@@ -20,7 +36,12 @@ func NewServer() (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Server{listener: listener}, nil
+	token, err := writeToken()
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &Server{listener: listener, token: token}, nil
 }
 
 func (s *Server) Start() {
@@ -44,6 +65,15 @@ func (s *Server) handle(conn net.Conn) {
 	}
 
 	line = strings.TrimSpace(line)
+	authenticated := false
+	if token, ok := strings.CutPrefix(line, authPrefix); ok {
+		authenticated = validToken(token, s.token)
+		if line, err = reader.ReadString('\n'); err != nil {
+			conn.Write([]byte("error:read failed\n"))
+			return
+		}
+		line = strings.TrimSpace(line)
+	}
 	parts := strings.SplitN(line, ":", 2)
 	if len(parts) < 2 {
 		conn.Write([]byte("error:invalid command format\n"))
@@ -51,6 +81,10 @@ func (s *Server) handle(conn net.Conn) {
 	}
 
 	cmd, arg := parts[0], parts[1]
+	if !authenticated && tokenCommands[cmd] {
+		conn.Write([]byte("error:permission denied: run as the user who started the orchestrator, or with sudo\n"))
+		return
+	}
 
 	switch cmd {
 	case "update":
@@ -88,6 +122,183 @@ func (s *Server) handle(conn net.Conn) {
 		}
 		conn.Write([]byte("ok:started\n"))
 
+	case "enable":
+		if err := services.Enable(arg); err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		conn.Write([]byte("ok:enabled\n"))
+
+	case "disable":
+		if err := services.Disable(arg); err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		conn.Write([]byte("ok:disabled\n"))
+
+	case "pin":
+		name, version, _ := strings.Cut(arg, "@")
+		if err := services.Pin(name, version); err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		conn.Write([]byte("ok:pinned\n"))
+
+	case "unpin":
+		if err := services.Unpin(arg); err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		conn.Write([]byte("ok:unpinned\n"))
+
+	case "start-env":
+		var req StartRequest
+		if err := json.Unmarshal([]byte(arg), &req); err != nil {
+			conn.Write([]byte("error:invalid start request\n"))
+			return
+		}
+		if err := services.StartWithEnv(req.Service, req.Env); err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		conn.Write([]byte("ok:{}\n"))
+
+	case "status":
+		report, err := services.GetReport(arg)
+		if err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		data, err := json.Marshal(report)
+		if err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		conn.Write([]byte(fmt.Sprintf("ok:%s\n", data)))
+
+	case "history":
+		var req HistoryRequest
+		if err := json.Unmarshal([]byte(arg), &req); err != nil {
+			conn.Write([]byte("error:invalid history request\n"))
+			return
+		}
+		runs, err := services.History(req.Service, req.Limit)
+		if err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		data, _ := json.Marshal(HistoryResponse{Runs: runs})
+		conn.Write([]byte(fmt.Sprintf("ok:%s\n", data)))
+
+	case "events":
+		var req EventsRequest
+		if err := json.Unmarshal([]byte(arg), &req); err != nil {
+			conn.Write([]byte("error:invalid events request\n"))
+			return
+		}
+		events, err := services.Events(req.Service, req.Limit)
+		if err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		data, _ := json.Marshal(EventsResponse{Events: events})
+		conn.Write([]byte(fmt.Sprintf("ok:%s\n", data)))
+
+	case "reconcile":
+		services.Reconcile()
+		conn.Write([]byte("ok:reconciled\n"))
+
+	case "install":
+		var req InstallRequest
+		if err := json.Unmarshal([]byte(arg), &req); err != nil {
+			conn.Write([]byte("error:invalid install request\n"))
+			return
+		}
+		resp, err := handleInstall(req)
+		if err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		data, _ := json.Marshal(resp)
+		conn.Write([]byte(fmt.Sprintf("ok:%s\n", data)))
+
+	case "plan", "apply":
+		var req ApplyRequest
+		if err := json.Unmarshal([]byte(arg), &req); err != nil {
+			conn.Write([]byte("error:invalid profile\n"))
+			return
+		}
+		resp, err := handleApply(cmd, req)
+		if err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		data, _ := json.Marshal(resp)
+		conn.Write([]byte(fmt.Sprintf("ok:%s\n", data)))
+
+	case "export":
+		var req ExportRequest
+		if err := json.Unmarshal([]byte(arg), &req); err != nil {
+			conn.Write([]byte("error:invalid export request\n"))
+			return
+		}
+		resp, err := handleExport(req)
+		if err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		data, _ := json.Marshal(resp)
+		conn.Write([]byte(fmt.Sprintf("ok:%s\n", data)))
+
+	case "import":
+		var req ImportRequest
+		if err := json.Unmarshal([]byte(arg), &req); err != nil {
+			conn.Write([]byte("error:invalid import request\n"))
+			return
+		}
+		data, _ := json.Marshal(handleImport(req))
+		conn.Write([]byte(fmt.Sprintf("ok:%s\n", data)))
+
+	case "env":
+		var req EnvRequest
+		if err := json.Unmarshal([]byte(arg), &req); err != nil {
+			conn.Write([]byte("error:invalid env request\n"))
+			return
+		}
+		resp, err := handleEnv(req)
+		if err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		data, _ := json.Marshal(resp)
+		conn.Write([]byte(fmt.Sprintf("ok:%s\n", data)))
+
+	case "secret":
+		var req SecretRequest
+		if err := json.Unmarshal([]byte(arg), &req); err != nil {
+			conn.Write([]byte("error:invalid secret request\n"))
+			return
+		}
+		resp, err := handleSecret(req)
+		if err != nil {
+			conn.Write([]byte(fmt.Sprintf("error:%s\n", err.Error())))
+			return
+		}
+		data, _ := json.Marshal(resp)
+		conn.Write([]byte(fmt.Sprintf("ok:%s\n", data)))
+
+	case "shutdown":
+		// Like every command in tokenCommands, only served with the token
+		shutdownMu.Lock()
+		cb := onShutdown
+		shutdownMu.Unlock()
+		if cb == nil {
+			conn.Write([]byte("error:not ready to shut down\n"))
+			return
+		}
+		conn.Write([]byte("ok:shutting down\n"))
+		go cb()
+
 	default:
 		conn.Write([]byte("error:unknown command\n"))
 	}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/services"
+)
+
+// authPrefix starts the optional first line of a request, which carries
+// the token from config.APITokenFile().
+const authPrefix = "auth:"
+
+// tokenCommands are only served with the token: they read or change env
+// files and secrets, or stop the orchestrator, and the API listens on
+// loopback, where any local user can connect. The other commands stay open
+// as they always were.
+var tokenCommands = map[string]bool{
+	"env":       true,
+	"start-env": true,
+	"secret":    true,
+	"export":    true,
+	"import":    true,
+	"history":   true,
+	"shutdown":  true,
+}
+
+// writeToken creates a fresh token for this run of the orchestrator.
+func writeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	path := config.APITokenFile()
+	tmpFile := path + ".tmp"
+	os.Remove(tmpFile)
+	if err := os.WriteFile(tmpFile, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write API token: %w", err)
+	}
+	services.ChownToInvoker(tmpFile)
+	if err := os.Rename(tmpFile, path); err != nil {
+		os.Remove(tmpFile)
+		return "", fmt.Errorf("failed to save API token: %w", err)
+	}
+	return token, nil
+}
+
+// readToken returns the running orchestrator's token, or "" when this user
+// can't read it.
+func readToken() string {
+	data, err := os.ReadFile(config.APITokenFile())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func validToken(got, want string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
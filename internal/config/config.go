@@ -5,14 +5,17 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/pink-tools/pink-core"
 )
 
 const (
-	RegistryURL = "https://raw.githubusercontent.com/pink-tools/pink-orchestrator/main/registry.yaml"
-	GitHubAPI   = "https://api.github.com"
-	DefaultPort = 7460
+	DefaultRegistryURL       = "https://raw.githubusercontent.com/pink-tools/pink-orchestrator/main/registry.yaml"
+	GitHubAPI                = "https://api.github.com"
+	DefaultPort              = 7460
+	DefaultRegistryInterval  = time.Hour
+	DefaultReconcileInterval = 30 * time.Second
 )
 
 func Port() int {
@@ -24,15 +27,120 @@ func Port() int {
 	return DefaultPort
 }
 
+// RegistryURL returns the registry location, overridable via ORCHESTRATOR_REGISTRY_URL.
+func RegistryURL() string {
+	if u := os.Getenv("ORCHESTRATOR_REGISTRY_URL"); u != "" {
+		return u
+	}
+	return DefaultRegistryURL
+}
+
+// RegistryInterval returns how often the registry is refreshed,
+// overridable via ORCHESTRATOR_REGISTRY_INTERVAL (Go duration, e.g. "30m").
+func RegistryInterval() time.Duration {
+	if v := os.Getenv("ORCHESTRATOR_REGISTRY_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return DefaultRegistryInterval
+}
+
+// ReconcileInterval returns how often desired service states are enforced,
+// overridable via ORCHESTRATOR_RECONCILE_INTERVAL; "0" turns it off.
+func ReconcileInterval() time.Duration {
+	if v := os.Getenv("ORCHESTRATOR_RECONCILE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return DefaultReconcileInterval
+}
+
 func HomeDir() string {
 	home, _ := os.UserHomeDir()
 	return home
 }
 
+// UserMode reports whether the orchestrator runs without root, keeping
+// everything under the user's home. Enabled via ORCHESTRATOR_USER_MODE=1
+// or the --user flag. Windows never needs elevation, so it is Unix only.
+func UserMode() bool {
+	if runtime.GOOS == "windows" {
+		return false
+	}
+	v, _ := strconv.ParseBool(os.Getenv("ORCHESTRATOR_USER_MODE"))
+	return v
+}
+
+// DataHome is $XDG_DATA_HOME, defaulting to ~/.local/share.
+func DataHome() string {
+	if d := os.Getenv("XDG_DATA_HOME"); d != "" && filepath.IsAbs(d) {
+		return d
+	}
+	return filepath.Join(HomeDir(), ".local", "share")
+}
+
+// ServiceHome is the HOME services get in user mode: a link to the user's
+// home inside DataHome. pink-core keeps service files next to the home
+// directory, so through the link they land in PinkToolsDir.
+func ServiceHome() string {
+	link := filepath.Join(DataHome(), "pink-home")
+	if target, err := os.Readlink(link); err != nil || target != HomeDir() {
+		if info, err := os.Lstat(link); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			os.Remove(link)
+		}
+		os.MkdirAll(DataHome(), 0755)
+		os.Symlink(HomeDir(), link)
+	}
+	return link
+}
+
+// BaseDir holds the shared pink-tools and orchestrator directories: the
+// parent of the home directory, or the XDG data dir in user mode.
+func BaseDir() string {
+	if UserMode() {
+		return DataHome()
+	}
+	return core.BaseDir()
+}
+
+// PinkToolsDir holds one directory per installed service.
+func PinkToolsDir() string {
+	return filepath.Join(BaseDir(), "pink-tools")
+}
+
+// ServiceDir returns a service's directory, creating it if needed.
+func ServiceDir(name string) string {
+	if !UserMode() {
+		return core.ServiceDir(name)
+	}
+	dir := filepath.Join(PinkToolsDir(), name)
+	os.MkdirAll(dir, 0755)
+	return dir
+}
+
+// BinDir is where service commands are linked: /usr/local/bin, or
+// ~/.local/bin in user mode.
+func BinDir() string {
+	if UserMode() {
+		return filepath.Join(HomeDir(), ".local", "bin")
+	}
+	return "/usr/local/bin"
+}
+
 func OrchestratorDir() string {
+	if UserMode() {
+		return filepath.Join(BaseDir(), "pink-orchestrator")
+	}
 	return filepath.Join(core.BaseDir(), ".pink-orchestrator")
 }
 
+// EventLogFile records the actions taken by the reconciler.
+func EventLogFile() string {
+	return filepath.Join(OrchestratorDir(), "events.jsonl")
+}
+
 func StateFile() string {
 	return filepath.Join(OrchestratorDir(), "state.json")
 }
@@ -41,20 +149,66 @@ func RegistryCacheFile() string {
 	return filepath.Join(OrchestratorDir(), "registry.yaml")
 }
 
+// RegistryMetaFile stores the source URL and HTTP validators of the cached registry.
+func RegistryMetaFile() string {
+	return filepath.Join(OrchestratorDir(), "registry.meta.json")
+}
+
+// RegistryOverlayFile holds local per-service overrides of registry fields.
+func RegistryOverlayFile() string {
+	return filepath.Join(OrchestratorDir(), "registry.local.yaml")
+}
+
+// HistoryDir holds one run history file per service.
+func HistoryDir() string {
+	return filepath.Join(OrchestratorDir(), "history")
+}
+
+// SecretsFile is the encrypted secret store.
+func SecretsFile() string {
+	return filepath.Join(OrchestratorDir(), "secrets.json")
+}
+
+// SecretKeyFile holds the random key the secret store is encrypted with.
+func SecretKeyFile() string {
+	return filepath.Join(OrchestratorDir(), "secret.key")
+}
+
+// APITokenFile holds the token API clients authenticate with. Only the
+// orchestrator's user and the user who started it can read it.
+func APITokenFile() string {
+	return filepath.Join(OrchestratorDir(), "api.token")
+}
+
 func ServiceBinary(name string) string {
 	bin := name
 	if runtime.GOOS == "windows" {
 		bin += ".exe"
 	}
-	return filepath.Join(core.ServiceDir(name), bin)
+	return filepath.Join(ServiceDir(name), bin)
+}
+
+// GlobalEnvFile holds variables applied to every service beneath its own .env.
+func GlobalEnvFile() string {
+	return filepath.Join(OrchestratorDir(), "global.env")
 }
 
 func ServiceEnvFile(name string) string {
-	return filepath.Join(core.ServiceDir(name), ".env")
+	return filepath.Join(ServiceDir(name), ".env")
 }
 
 func ServicePidFile(name string) string {
-	return filepath.Join(core.ServiceDir(name), name+".pid")
+	return filepath.Join(ServiceDir(name), name+".pid")
+}
+
+// ServiceLogFile receives a detached service's stdout.
+func ServiceLogFile(name string) string {
+	return filepath.Join(ServiceDir(name), name+".log")
+}
+
+// ServiceErrLogFile receives a detached service's stderr.
+func ServiceErrLogFile(name string) string {
+	return filepath.Join(ServiceDir(name), name+".err.log")
 }
 
 func Platform() string {
@@ -74,7 +228,7 @@ func BinaryName(service string) string {
 func EnsureDirs() error {
 	dirs := []string{
 		OrchestratorDir(),
-		core.PinkToolsDir(),
+		PinkToolsDir(),
 	}
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
@@ -84,8 +238,12 @@ func EnsureDirs() error {
 	return nil
 }
 
-// AgentClaudeDir returns agent's .claude directory (/Users/.claude).
+// AgentClaudeDir returns agent's .claude directory (/Users/.claude),
+// or the user's own ~/.claude in user mode.
 func AgentClaudeDir() string {
+	if UserMode() {
+		return ClaudeDir()
+	}
 	return filepath.Join(core.BaseDir(), ".claude")
 }
 
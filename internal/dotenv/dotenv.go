@@ -0,0 +1,314 @@
+// Package dotenv parses .env files following the common conventions:
+//
+//	# comment
+//	KEY=value                  # trailing comment
+//	export KEY=value
+//	KEY='literal $value'       # single quotes: no escapes, no expansion
+//	KEY="line\nbreak ${OTHER}" # double quotes: escapes and expansion
+//	KEY="spans
+//	several lines"
+//
+// Unquoted and double-quoted values expand ${VAR}, $VAR and ${VAR:-default},
+// looking up keys defined earlier in the file before the caller's lookup.
+package dotenv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Var is one assignment. Line and EndLine are 1-based and differ only for
+// quoted values that span several lines.
+type Var struct {
+	Key     string
+	Value   string
+	Line    int
+	EndLine int
+}
+
+// ParseError reports the line an error was found on.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Parse returns the assignments in data in file order. lookup resolves
+// variables not defined earlier in the file; a nil lookup disables
+// expansion and keeps references such as ${VAR} verbatim.
+func Parse(data []byte, lookup func(string) (string, bool)) ([]Var, error) {
+	p := &parser{
+		src:    strings.TrimPrefix(string(data), "\ufeff"),
+		line:   1,
+		lookup: lookup,
+		vars:   make(map[string]string),
+	}
+
+	var vars []Var
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return vars, nil
+		}
+		switch p.peek() {
+		case '\n':
+			p.next()
+			continue
+		case '#':
+			p.skipToEOL()
+			continue
+		}
+
+		v, err := p.assignment()
+		if err != nil {
+			return nil, err
+		}
+		p.vars[v.Key] = v.Value
+		vars = append(vars, v)
+	}
+}
+
+type parser struct {
+	src    string
+	pos    int
+	line   int
+	lookup func(string) (string, bool)
+	vars   map[string]string
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() byte {
+	return p.src[p.pos]
+}
+
+func (p *parser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func (p *parser) errorf(line int, format string, args ...any) error {
+	return &ParseError{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// skipBlank skips spaces, tabs and carriage returns but not newlines.
+func (p *parser) skipBlank() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) skipToEOL() {
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+}
+
+func isKeyStart(c byte) bool {
+	return c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+func isKeyChar(c byte) bool {
+	return isKeyStart(c) || (c >= '0' && c <= '9') || c == '.'
+}
+
+func (p *parser) key() string {
+	start := p.pos
+	for !p.eof() && isKeyChar(p.peek()) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *parser) assignment() (Var, error) {
+	v := Var{Line: p.line}
+
+	if p.eof() || !isKeyStart(p.peek()) {
+		return v, p.errorf(p.line, "expected variable name")
+	}
+	v.Key = p.key()
+
+	// "export KEY=..." as accepted by shells
+	if v.Key == "export" && !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.skipBlank()
+		if !p.eof() && isKeyStart(p.peek()) {
+			v.Key = p.key()
+		}
+	}
+
+	p.skipBlank()
+	if p.eof() || p.peek() != '=' {
+		return v, p.errorf(p.line, "expected '=' after %s", v.Key)
+	}
+	p.pos++
+	p.skipBlank()
+
+	var err error
+	if !p.eof() {
+		switch p.peek() {
+		case '\'':
+			v.Value, err = p.singleQuoted()
+		case '"':
+			v.Value, err = p.doubleQuoted()
+		default:
+			v.Value, err = p.unquoted()
+		}
+	}
+	if err != nil {
+		return v, err
+	}
+	v.EndLine = p.line
+
+	// Only a comment may follow a value on its line
+	p.skipBlank()
+	if !p.eof() && p.peek() != '\n' {
+		if p.peek() != '#' {
+			return v, p.errorf(p.line, "unexpected %q after value of %s", p.peek(), v.Key)
+		}
+		p.skipToEOL()
+	}
+	return v, nil
+}
+
+func (p *parser) singleQuoted() (string, error) {
+	start := p.line
+	p.next()
+	var b strings.Builder
+	for !p.eof() {
+		c := p.next()
+		if c == '\'' {
+			return b.String(), nil
+		}
+		b.WriteByte(c)
+	}
+	return "", p.errorf(start, "unterminated single-quoted value")
+}
+
+func (p *parser) doubleQuoted() (string, error) {
+	start := p.line
+	p.next()
+	var b strings.Builder
+	for !p.eof() {
+		c := p.next()
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				continue
+			}
+			switch e := p.next(); e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$':
+				b.WriteByte(e)
+			case '\n':
+				// line continuation
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		case '$':
+			if err := p.expand(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf(start, "unterminated double-quoted value")
+}
+
+func (p *parser) unquoted() (string, error) {
+	var b strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		if c == '\n' {
+			break
+		}
+		// '#' starts a comment only after whitespace, so KEY=a#b keeps its '#'
+		if c == '#' && (p.src[p.pos-1] == ' ' || p.src[p.pos-1] == '\t') {
+			break
+		}
+		p.pos++
+		switch {
+		case c == '\\' && !p.eof() && p.peek() == '$':
+			b.WriteByte(p.next())
+		case c == '$':
+			if err := p.expand(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return strings.TrimRight(b.String(), " \t\r"), nil
+}
+
+// expand handles a reference whose '$' has just been consumed.
+func (p *parser) expand(b *strings.Builder) error {
+	start := p.pos - 1
+	if p.eof() {
+		b.WriteByte('$')
+		return nil
+	}
+
+	var name, def string
+	hasDefault := false
+	switch c := p.peek(); {
+	case c == '{':
+		end := strings.IndexAny(p.src[p.pos:], "}\n")
+		if end < 0 || p.src[p.pos+end] != '}' {
+			return p.errorf(p.line, "unterminated ${ in value")
+		}
+		name = p.src[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+		if n, d, ok := strings.Cut(name, ":-"); ok {
+			name, def, hasDefault = n, d, true
+		}
+		if name == "" {
+			return p.errorf(p.line, "empty variable name in ${}")
+		}
+	case isKeyStart(c):
+		for !p.eof() && (isKeyStart(p.peek()) || (p.peek() >= '0' && p.peek() <= '9')) {
+			p.pos++
+		}
+		name = p.src[start+1 : p.pos]
+	default:
+		b.WriteByte('$')
+		return nil
+	}
+
+	if p.lookup == nil {
+		b.WriteString(p.src[start:p.pos])
+		return nil
+	}
+
+	value, ok := p.vars[name]
+	if !ok {
+		value, ok = p.lookup(name)
+	}
+	if (!ok || value == "") && hasDefault {
+		value = def
+	}
+	b.WriteString(value)
+	return nil
+}
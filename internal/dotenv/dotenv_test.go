@@ -0,0 +1,69 @@
+package dotenv
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	env := map[string]string{"HOME": "/home/pink", "EMPTY": ""}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+	tests := []struct {
+		name    string
+		data    string
+		lookup  func(string) (string, bool)
+		want    []Var
+		errLine int // 0 for no error
+	}{
+		{"empty", "", lookup, nil, 0},
+		{"comments and blanks", "# comment\n\n  \nA=1\n", lookup, []Var{{"A", "1", 4, 4}}, 0},
+		{"bom", "\ufeffA=1", lookup, []Var{{"A", "1", 1, 1}}, 0},
+		{"export", "export A=1\n", lookup, []Var{{"A", "1", 1, 1}}, 0},
+		{"key named export", "export=1\n", lookup, []Var{{"export", "1", 1, 1}}, 0},
+		{"spaces around =", "A = 1  \n", lookup, []Var{{"A", "1", 1, 1}}, 0},
+		{"empty value", "A=\nB=2\n", lookup, []Var{{"A", "", 1, 1}, {"B", "2", 2, 2}}, 0},
+		{"trailing comment", "A=1 # note\n", lookup, []Var{{"A", "1", 1, 1}}, 0},
+		{"hash inside value", "A=a#b\n", lookup, []Var{{"A", "a#b", 1, 1}}, 0},
+		{"crlf", "A=1\r\nB=2\r\n", lookup, []Var{{"A", "1", 1, 1}, {"B", "2", 2, 2}}, 0},
+		{"single quoted", `A='$HOME \n # x'`, lookup, []Var{{"A", `$HOME \n # x`, 1, 1}}, 0},
+		{"double quoted escapes", `A="a\nb\t\"c\" \$HOME \q"`, lookup, []Var{{"A", "a\nb\t\"c\" $HOME \\q", 1, 1}}, 0},
+		{"multiline", "A=\"one\ntwo\"\nB=3\n", lookup, []Var{{"A", "one\ntwo", 1, 2}, {"B", "3", 3, 3}}, 0},
+		{"expand lookup", "A=$HOME/x\nB=\"${HOME}/y\"\n", lookup, []Var{{"A", "/home/pink/x", 1, 1}, {"B", "/home/pink/y", 2, 2}}, 0},
+		{"expand earlier key", "A=1\nHOME=2\nB=${A}${HOME}\n", lookup, []Var{{"A", "1", 1, 1}, {"HOME", "2", 2, 2}, {"B", "12", 3, 3}}, 0},
+		{"expand default", "A=${MISSING:-x}\nB=${EMPTY:-y}\nC=${HOME:-z}\n", lookup,
+			[]Var{{"A", "x", 1, 1}, {"B", "y", 2, 2}, {"C", "/home/pink", 3, 3}}, 0},
+		{"expand missing", "A=[$MISSING]\n", lookup, []Var{{"A", "[]", 1, 1}}, 0},
+		{"escaped dollar", `A=\$HOME`, lookup, []Var{{"A", "$HOME", 1, 1}}, 0},
+		{"lone dollar", "A=$ 5$\n", lookup, []Var{{"A", "$ 5$", 1, 1}}, 0},
+		{"no lookup keeps references", "A=${HOME}\nB=$A\n", nil, []Var{{"A", "${HOME}", 1, 1}, {"B", "$A", 2, 2}}, 0},
+		{"missing =", "A=1\nB\n", lookup, nil, 2},
+		{"bad key", "1A=1\n", lookup, nil, 1},
+		{"unterminated single", "A=1\nB='x\n", lookup, nil, 2},
+		{"unterminated double", "A=\"x\n\ny\n", lookup, nil, 1},
+		{"unterminated brace", "A=${HOME\n", lookup, nil, 1},
+		{"empty brace", "A=${}\n", lookup, nil, 1},
+		{"text after quotes", "A=\"x\" y\n", lookup, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.data), tt.lookup)
+			if tt.errLine != 0 {
+				var perr *ParseError
+				if !errors.As(err, &perr) || perr.Line != tt.errLine {
+					t.Fatalf("Parse() error = %v, want a ParseError on line %d", err, tt.errLine)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
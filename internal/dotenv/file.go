@@ -0,0 +1,127 @@
+package dotenv
+
+import (
+	"regexp"
+	"strings"
+)
+
+// File is an editable .env document. Edits rewrite only the lines of the
+// affected assignments, so comments, blank lines and order are preserved.
+type File struct {
+	lines []string
+	vars  []Var
+}
+
+// NewFile parses data without expanding references.
+func NewFile(data []byte) (*File, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	vars, err := Parse([]byte(text), nil)
+	if err != nil {
+		return nil, err
+	}
+	text = strings.TrimSuffix(text, "\n")
+	var lines []string
+	if text != "" {
+		lines = strings.Split(text, "\n")
+	}
+	return &File{lines: lines, vars: vars}, nil
+}
+
+// Vars returns the assignments with values unexpanded.
+func (f *File) Vars() []Var {
+	return f.vars
+}
+
+// Get returns the effective (last) value of key.
+func (f *File) Get(key string) (string, bool) {
+	for i := len(f.vars) - 1; i >= 0; i-- {
+		if f.vars[i].Key == key {
+			return f.vars[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// Set replaces the effective assignment of key in place, or appends one.
+func (f *File) Set(key, value string) {
+	line := key + "=" + Quote(value)
+	for i := len(f.vars) - 1; i >= 0; i-- {
+		v := f.vars[i]
+		if v.Key != key {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(f.lines[v.Line-1]), "export ") {
+			line = "export " + line
+		}
+		f.replace(v.Line, v.EndLine, []string{line})
+		f.reparse()
+		return
+	}
+	f.Append(line)
+}
+
+// Unset removes every assignment of key and reports whether there was one.
+func (f *File) Unset(key string) bool {
+	found := false
+	for i := len(f.vars) - 1; i >= 0; i-- {
+		if v := f.vars[i]; v.Key == key {
+			f.replace(v.Line, v.EndLine, nil)
+			found = true
+		}
+	}
+	if found {
+		f.reparse()
+	}
+	return found
+}
+
+// Mentions reports whether key is assigned or present as a commented-out
+// placeholder such as "# KEY=".
+func (f *File) Mentions(key string) bool {
+	if _, ok := f.Get(key); ok {
+		return true
+	}
+	placeholder := regexp.MustCompile(`^\s*#\s*(export\s+)?` + regexp.QuoteMeta(key) + `\s*=`)
+	for _, line := range f.lines {
+		if placeholder.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// Append adds raw lines (assignments or comments) at the end of the file.
+func (f *File) Append(lines ...string) {
+	f.lines = append(f.lines, lines...)
+	f.reparse()
+}
+
+// Bytes returns the document with a trailing newline.
+func (f *File) Bytes() []byte {
+	if len(f.lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(f.lines, "\n") + "\n")
+}
+
+func (f *File) replace(first, last int, with []string) {
+	rest := append([]string{}, f.lines[last:]...)
+	f.lines = append(append(f.lines[:first-1], with...), rest...)
+}
+
+// reparse refreshes line numbers after an edit. Edits only produce
+// well-formed lines, so the document stays parseable.
+func (f *File) reparse() {
+	f.vars, _ = Parse(f.Bytes(), nil)
+}
+
+var bareValue = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+
+// Quote formats value so Parse reads it back literally.
+func Quote(value string) string {
+	if bareValue.MatchString(value) {
+		return value
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(value) + `"`
+}
@@ -0,0 +1,101 @@
+package dotenv
+
+import "testing"
+
+func TestFileSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		key   string
+		value string
+		want  string
+	}{
+		{"append to empty", "", "A", "1", "A=1\n"},
+		{"append", "# keep\nA=1\n", "B", "2", "# keep\nA=1\nB=2\n"},
+		{"replace in place", "A=1 # old\nB=2\n", "A", "3", "A=3\nB=2\n"},
+		{"replace last duplicate", "A=1\nA=2\n", "A", "3", "A=1\nA=3\n"},
+		{"keep export", "export A=1\n", "A", "2", "export A=2\n"},
+		{"replace multiline", "A=\"x\ny\"\nB=2\n", "A", "z", "A=z\nB=2\n"},
+		{"quote", "A=1\n", "A", "a b", "A=\"a b\"\n"},
+		{"no trailing newline", "A=1", "B", "2", "A=1\nB=2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFile([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Set(tt.key, tt.value)
+			if got := string(f.Bytes()); got != tt.want {
+				t.Errorf("Bytes() = %q, want %q", got, tt.want)
+			}
+			if got, ok := f.Get(tt.key); !ok || got != tt.value {
+				t.Errorf("Get(%s) = %q, %v, want %q", tt.key, got, ok, tt.value)
+			}
+		})
+	}
+}
+
+func TestFileUnset(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		key   string
+		found bool
+		want  string
+	}{
+		{"missing", "A=1\n", "B", false, "A=1\n"},
+		{"only", "A=1\n", "A", true, ""},
+		{"keeps comments", "# A\nA=1\nB=2\n", "A", true, "# A\nB=2\n"},
+		{"every duplicate", "A=1\nB=2\nA=3\n", "A", true, "B=2\n"},
+		{"multiline", "A=\"x\ny\"\nB=2\n", "A", true, "B=2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFile([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found := f.Unset(tt.key); found != tt.found {
+				t.Errorf("Unset() = %v, want %v", found, tt.found)
+			}
+			if got := string(f.Bytes()); got != tt.want {
+				t.Errorf("Bytes() = %q, want %q", got, tt.want)
+			}
+			if _, ok := f.Get(tt.key); ok {
+				t.Errorf("Get(%s) still finds a value", tt.key)
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		{"https://example.com/a?b=c", `"https://example.com/a?b=c"`},
+		{"user@host:/path,x+y=z%", "user@host:/path,x+y=z%"},
+		{"a b", `"a b"`},
+		{"$HOME", `"\$HOME"`},
+		{`back\slash "quoted"`, `"back\\slash \"quoted\""`},
+		{"line\nbreak\ttab\r", `"line\nbreak\ttab\r"`},
+		{"# not a comment", `"# not a comment"`},
+		{"it's", `"it's"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got := Quote(tt.value)
+			if got != tt.want {
+				t.Errorf("Quote() = %s, want %s", got, tt.want)
+			}
+			// Whatever the lookup, the value reads back literally
+			vars, err := Parse([]byte("A="+got), func(string) (string, bool) { return "x", true })
+			if err != nil || len(vars) != 1 || vars[0].Value != tt.value {
+				t.Errorf("Parse(Quote()) = %q, %v, want %q", vars, err, tt.value)
+			}
+		})
+	}
+}
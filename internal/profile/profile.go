@@ -0,0 +1,118 @@
+// Package profile reads machine profiles: YAML files declaring which
+// services a machine runs, at which versions and with which env values.
+//
+//	env:                        # global.env
+//	  LOG_LEVEL: info
+//	services:
+//	  pink-agent:
+//	    state: started          # started, stopped, disabled or absent
+//	    version: v1.4.0         # pinned; omit to follow the latest release
+//	    env:
+//	      TELEGRAM_TOKEN: secret://telegram-token
+//
+// Services and variables a profile doesn't mention are left alone.
+package profile
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Service states a profile can declare.
+const (
+	StateStarted  = "started"
+	StateStopped  = "stopped"
+	StateDisabled = "disabled"
+	StateAbsent   = "absent"
+)
+
+var envKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// Profile is a parsed profile file.
+type Profile struct {
+	Env      map[string]string  `yaml:"env,omitempty" json:"env,omitempty"`
+	Services map[string]Service `yaml:"services" json:"services"`
+}
+
+// Service is the declared state of one service.
+type Service struct {
+	// State defaults to started for daemons and stopped for other services
+	State   string            `yaml:"state,omitempty" json:"state,omitempty"`
+	Version string            `yaml:"version,omitempty" json:"version,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+}
+
+// Load reads and validates a profile file.
+func Load(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse decodes and validates a profile.
+func Parse(data []byte) (*Profile, error) {
+	var p Profile
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate checks states and variable names; services are checked against
+// the registry when the profile is planned.
+func (p *Profile) Validate() error {
+	if len(p.Services) == 0 && len(p.Env) == 0 {
+		return fmt.Errorf("profile declares no services or env")
+	}
+	if err := validateEnv(p.Env); err != nil {
+		return fmt.Errorf("env: %w", err)
+	}
+	for _, name := range p.Names() {
+		svc := p.Services[name]
+		switch svc.State {
+		case "", StateStarted, StateStopped, StateDisabled:
+		case StateAbsent:
+			if svc.Version != "" || len(svc.Env) > 0 {
+				return fmt.Errorf("%s: an absent service can't have a version or env", name)
+			}
+		default:
+			return fmt.Errorf("%s: unknown state %q", name, svc.State)
+		}
+		if err := validateEnv(svc.Env); err != nil {
+			return fmt.Errorf("%s: env: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Names returns the declared services in sorted order.
+func (p *Profile) Names() []string {
+	names := make([]string, 0, len(p.Services))
+	for name := range p.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateEnv(env map[string]string) error {
+	for key := range env {
+		if !envKeyRe.MatchString(key) {
+			return fmt.Errorf("invalid variable name: %q", key)
+		}
+	}
+	return nil
+}
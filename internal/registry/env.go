@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	EnvTypeString = "string"
+	EnvTypeInt    = "int"
+	EnvTypeBool   = "bool"
+	EnvTypeURL    = "url"
+	EnvTypeEnum   = "enum"
+	EnvTypePath   = "path"
+	EnvTypeSecret = "secret"
+)
+
+// IsSecret reports whether the value should be masked when displayed.
+func (ev EnvVar) IsSecret() bool {
+	return ev.Type == EnvTypeSecret
+}
+
+// Validate checks a non-empty value against the variable's type and rules.
+// Relative paths are resolved against dir. Unknown types are treated as
+// strings so registries can introduce types older orchestrators don't know.
+func (ev EnvVar) Validate(value, dir string) error {
+	switch ev.Type {
+	case EnvTypeInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		if ev.Min != nil && n < *ev.Min {
+			return fmt.Errorf("%d is less than %d", n, *ev.Min)
+		}
+		if ev.Max != nil && n > *ev.Max {
+			return fmt.Errorf("%d is greater than %d", n, *ev.Max)
+		}
+	case EnvTypeBool:
+		if _, err := parseBool(value); err != nil {
+			return err
+		}
+	case EnvTypeURL:
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%q is not an absolute URL", value)
+		}
+	case EnvTypeEnum:
+		found := false
+		for _, v := range ev.Values {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%q is not one of %s", value, strings.Join(ev.Values, ", "))
+		}
+	case EnvTypePath:
+		path := value
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("path %s does not exist", path)
+		}
+	}
+
+	if ev.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + ev.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid pattern in registry: %w", err)
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("does not match %s", ev.Pattern)
+		}
+	}
+
+	return nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "on":
+		return true, nil
+	case "0", "false", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not a boolean", value)
+}
@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Limits caps the resources of a service process. Zero values are unlimited.
+type Limits struct {
+	Memory string  `yaml:"memory,omitempty"` // bytes with optional K/M/G suffix, e.g. "2G"
+	CPU    float64 `yaml:"cpu,omitempty"`    // CPU cores, e.g. 1.5
+	PIDs   int     `yaml:"pids,omitempty"`   // processes and threads
+	Nice   int     `yaml:"nice,omitempty"`   // scheduling priority, -20..19
+	NoFile uint64  `yaml:"nofile,omitempty"` // open file descriptors
+}
+
+// MemoryBytes parses Memory; 0 means unlimited.
+func (l *Limits) MemoryBytes() (int64, error) {
+	s := strings.TrimSpace(strings.ToUpper(l.Memory))
+	if s == "" {
+		return 0, nil
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	if s == "" {
+		return 0, fmt.Errorf("invalid memory limit %q", l.Memory)
+	}
+	mult := int64(1)
+	switch s[len(s)-1] {
+	case 'K':
+		mult = 1 << 10
+	case 'M':
+		mult = 1 << 20
+	case 'G':
+		mult = 1 << 30
+	case 'T':
+		mult = 1 << 40
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid memory limit %q", l.Memory)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// Validate checks the limits are usable.
+func (l *Limits) Validate() error {
+	if _, err := l.MemoryBytes(); err != nil {
+		return err
+	}
+	if l.CPU < 0 || l.PIDs < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if l.Nice < -20 || l.Nice > 19 {
+		return fmt.Errorf("nice %d is outside -20..19", l.Nice)
+	}
+	return nil
+}
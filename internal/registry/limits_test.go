@@ -0,0 +1,41 @@
+package registry
+
+import "testing"
+
+func TestMemoryBytes(t *testing.T) {
+	tests := []struct {
+		memory  string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"  ", 0, false},
+		{"1024", 1024, false},
+		{"512K", 512 << 10, false},
+		{"512kb", 512 << 10, false},
+		{"256M", 256 << 20, false},
+		{"256MiB", 256 << 20, false},
+		{"2G", 2 << 30, false},
+		{"1.5g", 3 << 29, false},
+		{"1T", 1 << 40, false},
+		{" 2G ", 2 << 30, false},
+		{"B", 0, true},
+		{"G", 0, true},
+		{"0", 0, true},
+		{"-1G", 0, true},
+		{"two gigs", 0, true},
+		{"2X", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.memory, func(t *testing.T) {
+			l := &Limits{Memory: tt.memory}
+			got, err := l.MemoryBytes()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MemoryBytes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("MemoryBytes() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
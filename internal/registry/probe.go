@@ -0,0 +1,101 @@
+package registry
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	ProbeIPC  = "ipc"
+	ProbeTCP  = "tcp"
+	ProbeHTTP = "http"
+	ProbeExec = "exec"
+
+	DefaultProbeInterval  = 10 * time.Second
+	DefaultProbeTimeout   = 2 * time.Second
+	DefaultProbeThreshold = 3
+)
+
+// Probes are checks the orchestrator runs against a running daemon.
+// A failing readiness probe marks it not ready; a failing liveness probe
+// gets it restarted.
+type Probes struct {
+	Readiness *Probe `yaml:"readiness,omitempty"`
+	Liveness  *Probe `yaml:"liveness,omitempty"`
+}
+
+// Probe is a single check. Address, URL and Command may reference
+// ${SERVICE_DIR} and environment variables like args do.
+type Probe struct {
+	Kind    string   `yaml:"kind"`              // one of the Probe* constants
+	Address string   `yaml:"address,omitempty"` // tcp: host:port
+	URL     string   `yaml:"url,omitempty"`     // http: URL to GET
+	Status  int      `yaml:"status,omitempty"`  // http: expected status; default any 2xx
+	Command []string `yaml:"command,omitempty"` // exec: must exit 0
+
+	Interval         string `yaml:"interval,omitempty"`          // Go duration, default 10s
+	Timeout          string `yaml:"timeout,omitempty"`           // Go duration, default 2s
+	FailureThreshold int    `yaml:"failure_threshold,omitempty"` // consecutive failures, default 3
+	SuccessThreshold int    `yaml:"success_threshold,omitempty"` // consecutive successes, default 1
+}
+
+// Validate checks the probe is complete and its durations parse.
+func (p *Probe) Validate() error {
+	switch p.Kind {
+	case ProbeIPC:
+	case ProbeTCP:
+		if p.Address == "" {
+			return fmt.Errorf("tcp probe needs an address")
+		}
+	case ProbeHTTP:
+		if p.URL == "" {
+			return fmt.Errorf("http probe needs a url")
+		}
+	case ProbeExec:
+		if len(p.Command) == 0 {
+			return fmt.Errorf("exec probe needs a command")
+		}
+	default:
+		return fmt.Errorf("unknown probe kind %q", p.Kind)
+	}
+	if _, err := p.IntervalDuration(); err != nil {
+		return err
+	}
+	_, err := p.TimeoutDuration()
+	return err
+}
+
+func (p *Probe) IntervalDuration() (time.Duration, error) {
+	return parseProbeDuration(p.Interval, DefaultProbeInterval)
+}
+
+func (p *Probe) TimeoutDuration() (time.Duration, error) {
+	return parseProbeDuration(p.Timeout, DefaultProbeTimeout)
+}
+
+// Failures is the number of consecutive failures that flip the probe to failing.
+func (p *Probe) Failures() int {
+	if p.FailureThreshold > 0 {
+		return p.FailureThreshold
+	}
+	return DefaultProbeThreshold
+}
+
+// Successes is the number of consecutive successes that flip the probe to passing.
+func (p *Probe) Successes() int {
+	if p.SuccessThreshold > 0 {
+		return p.SuccessThreshold
+	}
+	return 1
+}
+
+func parseProbeDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid probe duration %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,45 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// DefaultReadyTimeout bounds how long a start waits for readiness.
+const DefaultReadyTimeout = 30 * time.Second
+
+// Readiness declares how to tell a started daemon is ready. Every check
+// that is set must pass; with none set, the daemon is ready once its IPC
+// port file appears and answers PING. TCP and HTTP may reference
+// environment variables like args do.
+type Readiness struct {
+	Log     string `yaml:"log,omitempty"`     // regexp matched against output lines
+	TCP     string `yaml:"tcp,omitempty"`     // host:port accepting connections
+	HTTP    string `yaml:"http,omitempty"`    // URL answering with a 2xx status
+	Timeout string `yaml:"timeout,omitempty"` // Go duration, default 30s
+}
+
+// TimeoutDuration parses Timeout, defaulting to DefaultReadyTimeout.
+func (r *Readiness) TimeoutDuration() (time.Duration, error) {
+	if r == nil || r.Timeout == "" {
+		return DefaultReadyTimeout, nil
+	}
+	d, err := time.ParseDuration(r.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid readiness timeout %q", r.Timeout)
+	}
+	return d, nil
+}
+
+// LogPattern compiles Log; nil when unset.
+func (r *Readiness) LogPattern() (*regexp.Regexp, error) {
+	if r == nil || r.Log == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(r.Log)
+	if err != nil {
+		return nil, fmt.Errorf("invalid readiness log pattern: %w", err)
+	}
+	return re, nil
+}
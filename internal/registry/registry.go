@@ -1,12 +1,16 @@
 package registry
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +19,23 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// SupportedVersion is the newest registry format this orchestrator understands.
+const SupportedVersion = 1
+
+// migrations upgrade a registry in memory: migrations[i] turns version i+1
+// into i+2. Registries published before the version field are version 1,
+// the only format so far, so there is nothing to migrate yet.
+var migrations []func(*Registry)
+
+// VersionError is returned for a registry newer than SupportedVersion.
+type VersionError struct {
+	Version int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("orchestrator update required for this registry (version %d, supported %d)", e.Version, SupportedVersion)
+}
+
 type Registry struct {
 	Version  int       `yaml:"version"`
 	Services []Service `yaml:"services"`
@@ -24,11 +45,57 @@ type Service struct {
 	Name         string      `yaml:"name"`
 	Repo         string      `yaml:"repo"`
 	Type         string      `yaml:"type"`
+	Binary       string      `yaml:"binary,omitempty"`
 	Dependencies []string    `yaml:"dependencies,omitempty"`
 	SystemDeps   []SystemDep `yaml:"system_deps,omitempty"`
 	EnvVars      []EnvVar    `yaml:"env_vars,omitempty"`
 	ExtraAssets  []Asset     `yaml:"extra_assets,omitempty"`
 	ClaudeRoot   bool        `yaml:"claude_root,omitempty"`
+
+	// Args and WorkDir may reference ${SERVICE_DIR}, ${HOME} and environment variables
+	Args    []string `yaml:"args,omitempty"`
+	WorkDir string   `yaml:"workdir,omitempty"`
+
+	// RunAs is "user" or "user:group"; empty means the user who invoked sudo
+	RunAs string `yaml:"run_as,omitempty"`
+	// Limits caps CPU, memory and process resources; enforced on Linux
+	Limits *Limits `yaml:"limits,omitempty"`
+	// Readiness tells when a started daemon can serve its dependents
+	Readiness *Readiness `yaml:"readiness,omitempty"`
+	// Probes are checked periodically while the daemon runs
+	Probes *Probes `yaml:"probes,omitempty"`
+
+	// SupportedPlatforms lists "<os>-<arch>" pairs the service ships for; empty means all
+	SupportedPlatforms []string `yaml:"supported_platforms,omitempty"`
+	// Platforms holds overrides keyed by "<os>" or "<os>-<arch>"
+	Platforms map[string]PlatformOverride `yaml:"platforms,omitempty"`
+}
+
+// PlatformOverride adjusts a service on one platform. Non-empty lists replace
+// the service-wide ones, except EnvVars which are merged by name.
+type PlatformOverride struct {
+	Binary       string      `yaml:"binary,omitempty"`
+	Dependencies []string    `yaml:"dependencies,omitempty"`
+	SystemDeps   []SystemDep `yaml:"system_deps,omitempty"`
+	EnvVars      []EnvVar    `yaml:"env_vars,omitempty"`
+	ExtraAssets  []Asset     `yaml:"extra_assets,omitempty"`
+}
+
+// Overlay holds local per-service overrides layered on top of the registry,
+// read from config.RegistryOverlayFile().
+type Overlay struct {
+	Services map[string]Override `yaml:"services"`
+}
+
+// Override replaces registry fields for one service. Nil fields are left alone,
+// so `args: []` clears registry arguments while omitting args keeps them.
+type Override struct {
+	Args      []string   `yaml:"args,omitempty"`
+	WorkDir   *string    `yaml:"workdir,omitempty"`
+	RunAs     *string    `yaml:"run_as,omitempty"`
+	Limits    *Limits    `yaml:"limits,omitempty"`
+	Readiness *Readiness `yaml:"readiness,omitempty"`
+	Probes    *Probes    `yaml:"probes,omitempty"`
 }
 
 type EnvVar struct {
@@ -36,6 +103,13 @@ type EnvVar struct {
 	Default     string `yaml:"default,omitempty"`
 	Required    bool   `yaml:"required,omitempty"`
 	Description string `yaml:"description,omitempty"`
+
+	// Type is one of the EnvType* constants; empty means string
+	Type    string   `yaml:"type,omitempty"`
+	Values  []string `yaml:"values,omitempty"`  // allowed values for enum
+	Pattern string   `yaml:"pattern,omitempty"` // regexp the whole value must match
+	Min     *int     `yaml:"min,omitempty"`     // bounds for int
+	Max     *int     `yaml:"max,omitempty"`
 }
 
 type Asset struct {
@@ -54,10 +128,29 @@ type SystemDep struct {
 }
 
 var (
-	cacheMu sync.RWMutex
-	cached  *Registry
+	cacheMu    sync.RWMutex
+	cached     *Registry
+	cachedData []byte
+	fetched    bool // cachedData is what the cache metadata's validators describe
+	onChange   func()
+	tooNew     *VersionError
 )
 
+// cacheMeta records where the cached registry came from and the validators
+// needed for a conditional refresh.
+type cacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// SetChangeCallback registers a function called after a refresh that changed the registry.
+func SetChangeCallback(cb func()) {
+	cacheMu.Lock()
+	onChange = cb
+	cacheMu.Unlock()
+}
+
 func Load() (*Registry, error) {
 	cacheMu.RLock()
 	if cached != nil {
@@ -73,65 +166,352 @@ func Load() (*Registry, error) {
 		return cached, nil
 	}
 
-	cacheFile := config.RegistryCacheFile()
-	if data, err := os.ReadFile(cacheFile); err == nil {
-		var reg Registry
-		if err := yaml.Unmarshal(data, &reg); err == nil {
-			cached = &reg
-			return cached, nil
+	// A cache fetched from a different URL belongs to another registry.
+	// Caches written before metadata existed came from the default URL.
+	cacheURL := loadMeta().URL
+	if cacheURL == "" {
+		cacheURL = config.DefaultRegistryURL
+	}
+	if cacheURL == config.RegistryURL() {
+		if data, err := os.ReadFile(config.RegistryCacheFile()); err == nil {
+			if reg, err := parse(data); err == nil {
+				cached, cachedData, fetched = reg, data, true
+				return cached, nil
+			}
 		}
 	}
 
 	if exe, err := os.Executable(); err == nil {
 		bundled := filepath.Join(filepath.Dir(exe), "registry.yaml")
 		if data, err := os.ReadFile(bundled); err == nil {
-			var reg Registry
-			if err := yaml.Unmarshal(data, &reg); err == nil {
-				cached = &reg
+			if reg, err := parse(data); err == nil {
+				cached, cachedData = reg, data
 				return cached, nil
 			}
 		}
 	}
 
-	return refreshLocked()
+	reg, _, err := refreshLocked()
+	return reg, err
 }
 
+// Refresh fetches the registry, sending the cached ETag and Last-Modified
+// so an unchanged registry costs a 304. Registered change callbacks run
+// when the fetched content differs from the one in use, or when a registry
+// too new to use appears or its version changes.
 func Refresh() (*Registry, error) {
 	cacheMu.Lock()
-	defer cacheMu.Unlock()
-	return refreshLocked()
+	reg, changed, err := refreshLocked()
+	cb := onChange
+	cacheMu.Unlock()
+
+	if changed && cb != nil {
+		cb()
+	}
+	return reg, err
+}
+
+// Watch refreshes the registry immediately and then every interval.
+func Watch(interval time.Duration) {
+	go func() {
+		for {
+			if _, err := Refresh(); err != nil {
+				otel.Warn(context.Background(), "registry refresh failed", otel.Attr{"error", err.Error()})
+			}
+			time.Sleep(interval)
+		}
+	}()
 }
 
-func refreshLocked() (*Registry, error) {
+func refreshLocked() (*Registry, bool, error) {
+	url := config.RegistryURL()
+	meta := loadMeta()
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return cached, false, fmt.Errorf("failed to fetch registry: %w", err)
+	}
+	// Validators only apply to the fetched copy from the same URL, not to
+	// the bundled registry
+	if meta.URL == url && fetched {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
 	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(config.RegistryURL)
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch registry: %w", err)
+		return cached, false, fmt.Errorf("failed to fetch registry: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return cached, false, nil
+	}
+
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("registry fetch failed: %d", resp.StatusCode)
+		return cached, false, fmt.Errorf("registry fetch failed: %d", resp.StatusCode)
 	}
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read registry: %w", err)
+		return cached, false, fmt.Errorf("failed to read registry: %w", err)
 	}
 
-	var reg Registry
-	if err := yaml.Unmarshal(data, &reg); err != nil {
-		return nil, fmt.Errorf("failed to parse registry: %w", err)
+	reg, err := parse(data)
+	var verr *VersionError
+	if errors.As(err, &verr) {
+		// Keep the compatible cache on disk and in memory
+		changed := tooNew == nil || tooNew.Version != verr.Version
+		if changed {
+			otel.Warn(context.Background(), verr.Error())
+		}
+		tooNew = verr
+		if cached == nil {
+			return nil, false, verr
+		}
+		return cached, changed, nil
 	}
+	if err != nil {
+		return cached, false, fmt.Errorf("failed to parse registry: %w", err)
+	}
+	tooNew = nil
 
 	if err := os.WriteFile(config.RegistryCacheFile(), data, 0644); err != nil {
 		otel.Warn(context.Background(), "failed to cache registry", otel.Attr{"error", err.Error()})
 	}
+	saveMeta(cacheMeta{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	})
+
+	changed := cached != nil && !bytes.Equal(data, cachedData)
+	cached, cachedData, fetched = reg, data, true
+	return cached, changed, nil
+}
+
+func parse(data []byte) (*Registry, error) {
+	var reg Registry
+	if err := yaml.Unmarshal(data, &reg); err != nil {
+		return nil, err
+	}
+	switch {
+	case reg.Version < 0:
+		return nil, fmt.Errorf("invalid registry version %d", reg.Version)
+	case reg.Version > SupportedVersion:
+		return nil, &VersionError{Version: reg.Version}
+	case reg.Version == 0:
+		reg.Version = 1
+	}
+	for reg.Version < SupportedVersion {
+		migrations[reg.Version-1](&reg)
+		reg.Version++
+	}
+	return &reg, nil
+}
+
+// Warning describes why the published registry is not in use, or "" if it is.
+// The last compatible registry keeps serving until the orchestrator is updated.
+func Warning() string {
+	cacheMu.RLock()
+	defer cacheMu.RUnlock()
+	if tooNew != nil {
+		return tooNew.Error()
+	}
+	return ""
+}
+
+func loadMeta() cacheMeta {
+	var meta cacheMeta
+	if data, err := os.ReadFile(config.RegistryMetaFile()); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+	return meta
+}
+
+func saveMeta(meta cacheMeta) {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(config.RegistryMetaFile(), data, 0644); err != nil {
+		otel.Warn(context.Background(), "failed to save registry metadata", otel.Attr{"error", err.Error()})
+	}
+}
+
+// Supports reports whether the service ships for platform ("<os>-<arch>").
+func (s Service) Supports(platform string) bool {
+	if len(s.SupportedPlatforms) == 0 {
+		return true
+	}
+	for _, p := range s.SupportedPlatforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// ForPlatform returns the service with overrides for platform applied,
+// the "<os>" entry first and the more specific "<os>-<arch>" entry last.
+func (s Service) ForPlatform(platform string) Service {
+	goos, _, _ := strings.Cut(platform, "-")
+	for _, key := range []string{goos, platform} {
+		o, ok := s.Platforms[key]
+		if !ok {
+			continue
+		}
+		if o.Binary != "" {
+			s.Binary = o.Binary
+		}
+		if len(o.Dependencies) > 0 {
+			s.Dependencies = o.Dependencies
+		}
+		if len(o.SystemDeps) > 0 {
+			s.SystemDeps = o.SystemDeps
+		}
+		if len(o.ExtraAssets) > 0 {
+			s.ExtraAssets = o.ExtraAssets
+		}
+		if len(o.EnvVars) > 0 {
+			s.EnvVars = mergeEnvVars(s.EnvVars, o.EnvVars)
+		}
+	}
+	s.Platforms = nil
+	return s
+}
 
-	cached = &reg
-	return cached, nil
+// BinaryAsset returns the release asset name of the service binary.
+func (s Service) BinaryAsset() string {
+	if s.Binary != "" {
+		return s.Binary
+	}
+	return config.BinaryName(s.Name)
 }
 
+func mergeEnvVars(base, overrides []EnvVar) []EnvVar {
+	merged := make([]EnvVar, len(base))
+	copy(merged, base)
+	for _, o := range overrides {
+		replaced := false
+		for i := range merged {
+			if merged[i].Name == o.Name {
+				merged[i] = o
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, o)
+		}
+	}
+	return merged
+}
+
+// LoadOverlay reads local overrides; a missing file is an empty overlay.
+func LoadOverlay() (*Overlay, error) {
+	overlay := &Overlay{}
+	data, err := os.ReadFile(config.RegistryOverlayFile())
+	if os.IsNotExist(err) {
+		return overlay, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, overlay); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", config.RegistryOverlayFile(), err)
+	}
+	return overlay, nil
+}
+
+// ParseOverlay decodes and validates local overrides, rejecting unknown
+// fields, before they are written to config.RegistryOverlayFile().
+func ParseOverlay(data []byte) (*Overlay, error) {
+	overlay := &Overlay{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(overlay); err != nil && err != io.EOF {
+		return nil, err
+	}
+	for name, o := range overlay.Services {
+		if err := o.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return overlay, nil
+}
+
+// Validate checks the overridden limits, readiness and probes are usable.
+func (o Override) Validate() error {
+	if o.Limits != nil {
+		if err := o.Limits.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.Readiness != nil {
+		if _, err := o.Readiness.TimeoutDuration(); err != nil {
+			return err
+		}
+		if _, err := o.Readiness.LogPattern(); err != nil {
+			return err
+		}
+	}
+	if o.Probes != nil {
+		for _, p := range []*Probe{o.Probes.Readiness, o.Probes.Liveness} {
+			if p == nil {
+				continue
+			}
+			if err := p.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve applies platform overrides and then local ones.
+func resolve(svc Service, overlay *Overlay) Service {
+	svc = svc.ForPlatform(config.Platform())
+	o, ok := overlay.Services[svc.Name]
+	if !ok {
+		return svc
+	}
+	if o.Args != nil {
+		svc.Args = o.Args
+	}
+	if o.WorkDir != nil {
+		svc.WorkDir = *o.WorkDir
+	}
+	if o.RunAs != nil {
+		svc.RunAs = *o.RunAs
+	}
+	if o.Limits != nil {
+		svc.Limits = o.Limits
+	}
+	if o.Readiness != nil {
+		svc.Readiness = o.Readiness
+	}
+	if o.Probes != nil {
+		svc.Probes = o.Probes
+	}
+	return svc
+}
+
+func loadOverlay() *Overlay {
+	overlay, err := LoadOverlay()
+	if err != nil {
+		otel.Warn(context.Background(), "ignoring registry overlay", otel.Attr{"error", err.Error()})
+		return &Overlay{}
+	}
+	return overlay
+}
+
+// GetService returns the service resolved for the current platform and local overrides.
 func GetService(name string) (*Service, error) {
 	reg, err := Load()
 	if err != nil {
@@ -140,19 +520,36 @@ func GetService(name string) (*Service, error) {
 
 	for _, svc := range reg.Services {
 		if svc.Name == name {
-			return &svc, nil
+			resolved := resolve(svc, loadOverlay())
+			return &resolved, nil
 		}
 	}
 
 	return nil, fmt.Errorf("service not found: %s", name)
 }
 
+// ListServices returns all services resolved like GetService,
+// including ones that do not support it (see IsSupported).
 func ListServices() ([]Service, error) {
 	reg, err := Load()
 	if err != nil {
 		return nil, err
 	}
-	return reg.Services, nil
+	overlay := loadOverlay()
+	svcs := make([]Service, 0, len(reg.Services))
+	for _, svc := range reg.Services {
+		svcs = append(svcs, resolve(svc, overlay))
+	}
+	return svcs, nil
+}
+
+// IsSupported reports whether the service ships for the current platform.
+func IsSupported(name string) bool {
+	svc, err := GetService(name)
+	if err != nil {
+		return false
+	}
+	return svc.Supports(config.Platform())
 }
 
 func IsDaemon(name string) bool {
@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr bool
+		newer   bool
+	}{
+		{"unversioned", "services: []\n", 1, false, false},
+		{"zero", "version: 0\nservices: []\n", 1, false, false},
+		{"current", "version: 1\nservices: []\n", 1, false, false},
+		{"negative", "version: -1\nservices: []\n", 0, true, false},
+		{"future", "version: 99\nservices: []\n", 0, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, err := parse([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var verr *VersionError
+			if errors.As(err, &verr) != tt.newer {
+				t.Fatalf("parse() error = %v, want VersionError %v", err, tt.newer)
+			}
+			if err == nil && reg.Version != tt.want {
+				t.Errorf("Version = %d, want %d", reg.Version, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	// parse steps through every version below SupportedVersion
+	if len(migrations) != SupportedVersion-1 {
+		t.Fatalf("%d migrations for supported version %d", len(migrations), SupportedVersion)
+	}
+}
+
+func TestRefreshValidators(t *testing.T) {
+	const body = "version: 1\nservices: []\n"
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	t.Setenv("ORCHESTRATOR_USER_MODE", "1")
+	t.Setenv("XDG_DATA_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("ORCHESTRATOR_REGISTRY_URL", server.URL)
+	os.MkdirAll(config.OrchestratorDir(), 0755)
+	// Validators saved for the cache file, while the bundled registry is in use
+	saveMeta(cacheMeta{URL: server.URL, ETag: `"v1"`})
+	bundled, _ := parse([]byte(body))
+	cacheMu.Lock()
+	cached, cachedData, fetched = bundled, []byte(body), false
+	cacheMu.Unlock()
+	t.Cleanup(func() {
+		cacheMu.Lock()
+		cached, cachedData, fetched = nil, nil, false
+		cacheMu.Unlock()
+	})
+
+	for range 2 {
+		if _, err := Refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got) != 2 || got[0] != "" || got[1] != `"v1"` {
+		t.Errorf("If-None-Match sent = %q, want none and then %q", got, `"v1"`)
+	}
+}
@@ -0,0 +1,404 @@
+// Package secrets keeps service secrets encrypted at rest. Values are sealed
+// with AES-256-GCM under a random key file, optionally combined with a
+// passphrase, and referenced from .env files as secret://<name>.
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+)
+
+// Prefix marks a .env value as a reference into the store.
+const Prefix = "secret://"
+
+const (
+	keySize          = 32
+	pbkdf2Iterations = 600000
+)
+
+var (
+	// ErrLocked is returned when the store needs a passphrase that hasn't been given.
+	ErrLocked = errors.New("secret store is locked: set ORCHESTRATOR_SECRETS_PASSPHRASE or run 'pink-orchestrator secret unlock'")
+
+	nameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+	mu         sync.Mutex
+	passphrase = os.Getenv("ORCHESTRATOR_SECRETS_PASSPHRASE")
+
+	// derived caches the last passphrase key, which is slow to derive;
+	// guarded by mu
+	derived struct {
+		salt, key  []byte
+		passphrase string
+	}
+)
+
+// envelope is the on-disk format of the store.
+type envelope struct {
+	Version    int    `json:"version"`
+	Passphrase bool   `json:"passphrase"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// IsRef reports whether a .env value references the store.
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Resolve returns the secret a secret://<name> reference points to.
+func Resolve(ref string) (string, error) {
+	name := strings.TrimPrefix(ref, Prefix)
+	mu.Lock()
+	defer mu.Unlock()
+
+	values, err := load()
+	if err != nil {
+		return "", err
+	}
+	value, ok := values[name]
+	if !ok {
+		return "", fmt.Errorf("secret %q not found", name)
+	}
+	return value, nil
+}
+
+// List returns the names of stored secrets.
+func List() ([]string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	values, err := load()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Set stores or replaces a secret.
+func Set(name, value string) error {
+	if !nameRe.MatchString(name) {
+		return fmt.Errorf("invalid secret name: %q", name)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	values, err := load()
+	if err != nil {
+		return err
+	}
+	values[name] = value
+	return store(values)
+}
+
+// Delete removes a secret.
+func Delete(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	values, err := load()
+	if err != nil {
+		return err
+	}
+	if _, ok := values[name]; !ok {
+		return fmt.Errorf("secret %q not found", name)
+	}
+	delete(values, name)
+	return store(values)
+}
+
+// Unlock checks a passphrase against the store and keeps it for this process.
+func Unlock(p string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	prev := passphrase
+	passphrase = p
+	if _, err := load(); err != nil {
+		passphrase = prev
+		return err
+	}
+	return nil
+}
+
+// Rotate re-encrypts every secret under a fresh key file. A non-nil
+// newPassphrase replaces the passphrase; an empty one removes it.
+func Rotate(newPassphrase *string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	values, err := load()
+	if err != nil {
+		return err
+	}
+
+	// The new key stays pending until the store is saved under it, so a
+	// failure leaves the old key and store in place
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
+	pending := pendingKeyFile()
+	if err := os.WriteFile(pending, key, 0600); err != nil {
+		return fmt.Errorf("failed to write secret key: %w", err)
+	}
+	oldPassphrase := passphrase
+	if newPassphrase != nil {
+		passphrase = *newPassphrase
+	}
+	if err := save(values, key, passphrase != ""); err != nil {
+		os.Remove(pending)
+		passphrase = oldPassphrase
+		return err
+	}
+	if err := os.Rename(pending, config.SecretKeyFile()); err != nil {
+		// load finds the pending key the next time
+		return fmt.Errorf("failed to replace secret key: %w", err)
+	}
+	return nil
+}
+
+// Values returns every stored secret by name.
+func Values() (map[string]string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return load()
+}
+
+// sealed is data encrypted under a passphrase alone, so it can be opened on
+// another machine without the key file.
+type sealed struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Seal encrypts data under a passphrase.
+func Seal(data []byte, p string) ([]byte, error) {
+	salt := make([]byte, keySize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := passphraseAEAD(p, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealed{
+		Version: 1,
+		Salt:    salt,
+		Nonce:   nonce,
+		Data:    aead.Seal(nil, nonce, data, nil),
+	})
+}
+
+// Open decrypts data sealed with Seal.
+func Open(data []byte, p string) ([]byte, error) {
+	var s sealed
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("corrupt sealed data: %w", err)
+	}
+	aead, err := passphraseAEAD(p, s.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, s.Nonce, s.Data, nil)
+	if err != nil {
+		return nil, errors.New("cannot decrypt: wrong passphrase")
+	}
+	return plain, nil
+}
+
+func passphraseAEAD(p string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, p, salt, pbkdf2Iterations, keySize)
+	if err != nil {
+		return nil, err
+	}
+	return gcm(key)
+}
+
+// load decrypts the store; a missing store is empty. Callers hold mu.
+func load() (map[string]string, error) {
+	values := make(map[string]string)
+	data, err := os.ReadFile(config.SecretsFile())
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("corrupt secret store: %w", err)
+	}
+	if env.Passphrase && passphrase == "" {
+		return nil, ErrLocked
+	}
+
+	key, err := readKey(config.SecretKeyFile())
+	if err != nil {
+		return nil, err
+	}
+	plain, err := open(env, key)
+	if err != nil {
+		// A rotation that stopped after saving the store left its key pending
+		pending := pendingKeyFile()
+		if key, perr := readKey(pending); perr == nil {
+			if plain, perr = open(env, key); perr == nil {
+				err = os.Rename(pending, config.SecretKeyFile())
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return nil, fmt.Errorf("corrupt secret store: %w", err)
+	}
+	return values, nil
+}
+
+// open decrypts the store's data under a key file's key.
+func open(env envelope, key []byte) ([]byte, error) {
+	aead, err := newAEAD(key, env.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, env.Nonce, env.Data, nil)
+	if err != nil {
+		if env.Passphrase {
+			return nil, errors.New("cannot decrypt secret store: wrong passphrase")
+		}
+		return nil, errors.New("cannot decrypt secret store: key file does not match")
+	}
+	return plain, nil
+}
+
+// store writes values under the current key file, creating it when it
+// doesn't exist. Callers hold mu.
+func store(values map[string]string) error {
+	keyFile := config.SecretKeyFile()
+	if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+		key, err := newKey()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(keyFile, key, 0600); err != nil {
+			return fmt.Errorf("failed to write secret key: %w", err)
+		}
+	}
+	key, err := readKey(keyFile)
+	if err != nil {
+		return err
+	}
+	return save(values, key, passphrase != "")
+}
+
+// save encrypts the store under key and atomically writes it. Callers hold mu.
+func save(values map[string]string, key []byte, withPassphrase bool) error {
+	aead, err := newAEAD(key, withPassphrase)
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(envelope{
+		Version:    1,
+		Passphrase: withPassphrase,
+		Nonce:      nonce,
+		Data:       aead.Seal(nil, nonce, plain, nil),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := config.SecretsFile()
+	tmpFile := path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secret store: %w", err)
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to save secret store: %w", err)
+	}
+	return nil
+}
+
+func newAEAD(key []byte, withPassphrase bool) (cipher.AEAD, error) {
+	if withPassphrase {
+		// The key file salts the passphrase: both are needed to decrypt
+		if !bytes.Equal(derived.salt, key) || derived.passphrase != passphrase {
+			k, err := pbkdf2.Key(sha256.New, passphrase, key, pbkdf2Iterations, keySize)
+			if err != nil {
+				return nil, err
+			}
+			derived.salt, derived.key, derived.passphrase = key, k, passphrase
+		}
+		key = derived.key
+	}
+	return gcm(key)
+}
+
+func gcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readKey reads and checks a key file.
+func readKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret key: %w", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("invalid secret key file %s", path)
+	}
+	return key, nil
+}
+
+func newKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// pendingKeyFile holds a rotated key until the store is saved under it.
+func pendingKeyFile() string {
+	return config.SecretKeyFile() + ".new"
+}
@@ -0,0 +1,465 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/pink-tools/pink-otel"
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/profile"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+	"github.com/pink-tools/pink-orchestrator/internal/secrets"
+)
+
+// Kinds of profile changes.
+const (
+	ChangeInstall   = "install"
+	ChangeUninstall = "uninstall"
+	ChangeVersion   = "version"
+	ChangePin       = "pin"
+	ChangeEnv       = "env"
+	ChangeState     = "state"
+	ChangeStart     = "start"
+	ChangeStop      = "stop"
+	ChangeRestart   = "restart"
+)
+
+// ActionRestart is logged when applying a profile restarts a service to
+// pick up changed env values.
+const ActionRestart = "restart"
+
+// convergeSteps bounds the actions taken on one service while applying a
+// profile: uninstall, or install or update followed by start or stop.
+const convergeSteps = 3
+
+// Change is one difference between a profile and the machine.
+type Change struct {
+	Service string `json:"service"` // GlobalEnv for global.env
+	Kind    string `json:"kind"`
+	Key     string `json:"key,omitempty"` // variable of an env change
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+}
+
+func (c Change) String() string {
+	or := func(s, fallback string) string {
+		if s == "" {
+			return fallback
+		}
+		return s
+	}
+	switch c.Kind {
+	case ChangeInstall:
+		return "+ install " + or(c.To, "latest")
+	case ChangeUninstall:
+		return "- uninstall"
+	case ChangeVersion:
+		return fmt.Sprintf("~ version %s → %s", or(c.From, "unknown"), c.To)
+	case ChangePin:
+		return fmt.Sprintf("~ pin %s → %s", or(c.From, "none"), or(c.To, "none"))
+	case ChangeEnv:
+		if c.From == "" {
+			return fmt.Sprintf("+ %s=%s", c.Key, c.To)
+		}
+		return fmt.Sprintf("~ %s: %s → %s", c.Key, c.From, c.To)
+	case ChangeState:
+		return fmt.Sprintf("~ state %s → %s", or(c.From, "unmanaged"), c.To)
+	case ChangeStart:
+		return "+ start"
+	case ChangeStop:
+		return "- stop"
+	case ChangeRestart:
+		return "~ restart (env changed)"
+	}
+	return c.Kind
+}
+
+// Plan is the list of changes that bring the machine to a profile, grouped
+// by service in profile order, then restarts of the other services a global
+// env change reaches.
+type Plan struct {
+	Changes []Change `json:"changes"`
+}
+
+// PlanProfile compares a profile with the machine.
+func PlanProfile(p *profile.Profile) (Plan, error) {
+	var plan Plan
+
+	changes, err := planEnv(GlobalEnv, p.Env)
+	if err != nil {
+		return plan, err
+	}
+	plan.Changes = append(plan.Changes, changes...)
+	global := make([]string, 0, len(changes))
+	for _, c := range changes {
+		global = append(global, c.Key)
+	}
+
+	for _, name := range p.Names() {
+		svc, err := registry.GetService(name)
+		if err != nil {
+			return plan, err
+		}
+		if !svc.Supports(config.Platform()) {
+			return plan, fmt.Errorf("%s is not available for %s", name, config.Platform())
+		}
+		changes, err := planService(svc, p.Services[name])
+		if err != nil {
+			return plan, fmt.Errorf("%s: %w", name, err)
+		}
+		if restart, err := planGlobalRestart(svc, global, p.Services[name].Env, changes); err != nil {
+			return plan, fmt.Errorf("%s: %w", name, err)
+		} else if restart != nil {
+			changes = append(changes, *restart)
+		}
+		plan.Changes = append(plan.Changes, changes...)
+	}
+
+	// Running services outside the profile pick up global env changes too
+	if len(global) > 0 {
+		svcs, err := registry.ListServices()
+		if err != nil {
+			return plan, err
+		}
+		for _, svc := range svcs {
+			if _, ok := p.Services[svc.Name]; ok || !svc.Supports(config.Platform()) {
+				continue
+			}
+			restart, err := planGlobalRestart(&svc, global, nil, nil)
+			if err != nil {
+				return plan, fmt.Errorf("%s: %w", svc.Name, err)
+			}
+			if restart != nil {
+				plan.Changes = append(plan.Changes, *restart)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// planGlobalRestart returns a restart of svc when it's a running daemon
+// that inherits one of the changed global keys: neither its env file nor
+// the profile's values for it set the key. changes are the service's own
+// planned changes; a start, stop, restart or binary change covers it.
+func planGlobalRestart(svc *registry.Service, keys []string, values map[string]string, changes []Change) (*Change, error) {
+	if len(keys) == 0 || svc.Type != "daemon" || GetStatus(svc.Name).Status != StatusRunning {
+		return nil, nil
+	}
+	for _, c := range changes {
+		switch c.Kind {
+		case ChangeInstall, ChangeUninstall, ChangeVersion, ChangeStart, ChangeStop, ChangeRestart:
+			return nil, nil
+		}
+	}
+	f, err := readEnvFile(svc.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		if _, ok := f.Get(key); !ok {
+			return &Change{Service: svc.Name, Kind: ChangeRestart}, nil
+		}
+	}
+	return nil, nil
+}
+
+// profileState is the state a profile declares for svc, with the default.
+func profileState(svc *registry.Service, sp profile.Service) string {
+	if sp.State != "" {
+		return sp.State
+	}
+	if svc.Type == "daemon" {
+		return DesiredStarted
+	}
+	return DesiredStopped
+}
+
+func planService(svc *registry.Service, sp profile.Service) ([]Change, error) {
+	name := svc.Name
+	state := profileState(svc, sp)
+	rec := Record(name)
+	if rec == nil {
+		rec = &ServiceRecord{}
+	}
+	installed := IsInstalled(name)
+	change := func(kind, from, to string) Change {
+		return Change{Service: name, Kind: kind, From: from, To: to}
+	}
+
+	if state == DesiredAbsent {
+		if installed {
+			return []Change{change(ChangeUninstall, "", "")}, nil
+		}
+		if rec.Desired != "" && rec.Desired != DesiredAbsent {
+			return []Change{change(ChangeState, rec.Desired, DesiredAbsent)}, nil
+		}
+		return nil, nil
+	}
+
+	var changes []Change
+	binaryChange := false
+	if !installed {
+		changes = append(changes, change(ChangeInstall, "", sp.Version))
+		binaryChange = true
+	} else if sp.Version != "" {
+		version := rec.Version
+		if version == "" {
+			version = GetInstalledVersion(name)
+		}
+		if !sameVersion(version, sp.Version) {
+			changes = append(changes, change(ChangeVersion, version, sp.Version))
+			binaryChange = true
+		}
+	}
+	if !sameVersion(rec.Pin, sp.Version) && !(binaryChange && sp.Version != "") {
+		changes = append(changes, change(ChangePin, rec.Pin, sp.Version))
+	}
+
+	envChanges, err := planEnv(name, sp.Env)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, envChanges...)
+
+	if rec.Desired != state {
+		changes = append(changes, change(ChangeState, rec.Desired, state))
+	}
+	if svc.Type == "daemon" {
+		running := GetStatus(name).Status == StatusRunning
+		switch {
+		case state == DesiredStarted && !running:
+			changes = append(changes, change(ChangeStart, "", ""))
+		case state != DesiredStarted && running:
+			changes = append(changes, change(ChangeStop, "", ""))
+		case running && len(envChanges) > 0 && !binaryChange:
+			// Replacing the binary restarts the service anyway
+			changes = append(changes, change(ChangeRestart, "", ""))
+		}
+	}
+	return changes, nil
+}
+
+// planEnv lists the variables of values that differ from name's env file.
+// Secret values are masked.
+func planEnv(name string, values map[string]string) ([]Change, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	f, err := readEnvFile(name)
+	if err != nil {
+		return nil, err
+	}
+	declared := declaredEnv(name)
+	mask := func(key, value string) string {
+		if value != "" && declared[key].IsSecret() && !secrets.IsRef(value) {
+			return secretMask
+		}
+		return value
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var changes []Change
+	for _, key := range keys {
+		current, ok := f.Get(key)
+		if ok && current == values[key] {
+			continue
+		}
+		changes = append(changes, Change{Service: name, Kind: ChangeEnv, Key: key,
+			From: mask(key, current), To: mask(key, values[key])})
+	}
+	return changes, nil
+}
+
+// ApplyProfile converges the machine to a profile and returns the plan it
+// carried out. Services are applied one by one; a failure is reported
+// after the remaining services have been applied.
+func ApplyProfile(p *profile.Profile, progress func(string)) (Plan, error) {
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+
+	plan, err := PlanProfile(p)
+	if err != nil || len(plan.Changes) == 0 {
+		return plan, err
+	}
+
+	var errs []error
+	if values := changedEnv(plan, GlobalEnv, p.Env); len(values) > 0 {
+		if err := SetEnv(GlobalEnv, values); err != nil {
+			errs = append(errs, fmt.Errorf("global env: %w", err))
+		} else {
+			progress("global env updated")
+		}
+	}
+	for _, name := range p.Names() {
+		if err := applyService(name, p.Services[name], plan, progress); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	for _, c := range plan.Changes {
+		if _, ok := p.Services[c.Service]; ok || c.Kind != ChangeRestart {
+			continue
+		}
+		err := Restart(c.Service)
+		logApplyEvent(c.Service, ActionRestart, "profile: global env changed", err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Service, err))
+			continue
+		}
+		progress(fmt.Sprintf("%s: restarted", c.Service))
+	}
+	return plan, errors.Join(errs...)
+}
+
+// ApplyProfileDryRun plans a profile and walks the steps applying it would
+// take, reporting each action without taking it.
+func ApplyProfileDryRun(p *profile.Profile, progress func(string)) (Plan, error) {
+	plan, err := PlanProfile(p)
+	if err != nil {
+		return plan, err
+	}
+	for _, c := range plan.Changes {
+		in := &installer{dryRun: true, progress: func(msg string) {
+			progress(fmt.Sprintf("%s: %s", c.Service, msg))
+		}}
+		switch c.Kind {
+		case ChangeInstall:
+			err = in.install(c.Service, c.To)
+		case ChangeVersion:
+			err = in.replace(c.Service, c.To)
+		case ChangeUninstall:
+			in.uninstall(c.Service)
+		case ChangeEnv:
+			in.would("set %s in %s", c.Key, envFileName(c.Service))
+		case ChangePin, ChangeState:
+			in.would("record %s %s", c.Kind, c.To)
+		case ChangeStart, ChangeStop, ChangeRestart:
+			in.would("%s %s", c.Kind, c.Service)
+		}
+		if err != nil {
+			return plan, fmt.Errorf("%s: %w", c.Service, err)
+		}
+	}
+	return plan, nil
+}
+
+// envFileName is the env file an env change of service lands in.
+func envFileName(service string) string {
+	if service == GlobalEnv {
+		return config.GlobalEnvFile()
+	}
+	return config.ServiceEnvFile(service)
+}
+
+func applyService(name string, sp profile.Service, plan Plan, progress func(string)) error {
+	svc, err := registry.GetService(name)
+	if err != nil {
+		return err
+	}
+	state := profileState(svc, sp)
+	restart := false
+	for _, c := range plan.Changes {
+		if c.Service == name && c.Kind == ChangeRestart {
+			restart = true
+		}
+	}
+
+	updateRecord(name, func(rec *ServiceRecord) {
+		rec.Desired = state
+		if state != DesiredAbsent {
+			rec.Pin = sp.Version
+		}
+	})
+
+	// Binary first, so the env file lands next to an installed service. The
+	// reconciler only installs started services; a profile installs any
+	if state != DesiredAbsent && !IsInstalled(name) {
+		progress(fmt.Sprintf("%s: %s (not installed)", name, ActionInstall))
+		err := runAction(name, ActionInstall, Record(name))
+		logApplyEvent(name, ActionInstall, "profile: not installed", err)
+		if err != nil {
+			return err
+		}
+	}
+	if err := converge(name, "profile", progress, ActionInstall, ActionUninstall, ActionUpdate); err != nil {
+		return err
+	}
+	if state == DesiredAbsent {
+		return nil
+	}
+
+	if values := changedEnv(plan, name, sp.Env); len(values) > 0 {
+		if err := SetEnv(name, values); err != nil {
+			return err
+		}
+		progress(fmt.Sprintf("%s: env updated", name))
+	}
+	if restart {
+		err := Restart(name)
+		logApplyEvent(name, ActionRestart, "profile: env changed", err)
+		if err != nil {
+			return err
+		}
+		progress(fmt.Sprintf("%s: restarted", name))
+	}
+
+	return converge(name, "profile", progress, ActionStart, ActionStop)
+}
+
+// converge takes the reconciler's actions of the given kinds on a service
+// until none is left. source tells the logged events apart from the
+// reconciler's own.
+func converge(name, source string, progress func(string), kinds ...string) error {
+	svc, err := registry.GetService(name)
+	if err != nil {
+		return err
+	}
+	for range convergeSteps {
+		rec := Record(name)
+		if rec == nil {
+			return nil
+		}
+		action, reason := plannedAction(*svc, rec)
+		if action == "" || !slices.Contains(kinds, action) {
+			return nil
+		}
+		progress(fmt.Sprintf("%s: %s (%s)", name, action, reason))
+		err := runAction(name, action, rec)
+		logApplyEvent(name, action, source+": "+reason, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func logApplyEvent(name, action, reason string, err error) {
+	event := Event{Time: time.Now(), Service: name, Action: action, Reason: reason}
+	if err != nil {
+		event.Error = err.Error()
+		otel.Warn(context.Background(), name, otel.Attr{"status", action + " failed"}, otel.Attr{"error", err.Error()})
+	}
+	logEvent(event)
+}
+
+// changedEnv picks the values of a service's env changes in plan.
+func changedEnv(plan Plan, name string, values map[string]string) map[string]string {
+	changed := make(map[string]string)
+	for _, c := range plan.Changes {
+		if c.Service == name && c.Kind == ChangeEnv {
+			changed[c.Key] = values[c.Key]
+		}
+	}
+	return changed
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/profile"
+)
+
+func TestPlanProfile(t *testing.T) {
+	started := &ServiceRecord{Desired: DesiredStarted}
+	tests := []struct {
+		name    string
+		profile profile.Profile
+		setup   func(t *testing.T)
+		want    []Change
+	}{
+		{
+			name:    "install stopped",
+			profile: profile.Profile{Services: map[string]profile.Service{"svc-daemon": {State: DesiredStopped}}},
+			want: []Change{
+				{Service: "svc-daemon", Kind: ChangeInstall},
+				{Service: "svc-daemon", Kind: ChangeState, To: DesiredStopped},
+			},
+		},
+		{
+			name:    "nothing to do",
+			profile: profile.Profile{Services: map[string]profile.Service{"svc-daemon": {}}},
+			setup:   func(t *testing.T) { fakeService(t, "svc-daemon", started, true, true) },
+		},
+		{
+			name:    "service env restarts",
+			profile: profile.Profile{Services: map[string]profile.Service{"svc-daemon": {Env: map[string]string{"A": "1"}}}},
+			setup:   func(t *testing.T) { fakeService(t, "svc-daemon", started, true, true) },
+			want: []Change{
+				{Service: "svc-daemon", Kind: ChangeEnv, Key: "A", To: "1"},
+				{Service: "svc-daemon", Kind: ChangeRestart},
+			},
+		},
+		{
+			name:    "global env restarts inheriting services",
+			profile: profile.Profile{Env: map[string]string{"A": "1"}, Services: map[string]profile.Service{"svc-daemon": {}}},
+			setup: func(t *testing.T) {
+				fakeService(t, "svc-daemon", started, true, true)
+				fakeService(t, "svc-other", started, true, true)
+			},
+			want: []Change{
+				{Service: GlobalEnv, Kind: ChangeEnv, Key: "A", To: "1"},
+				{Service: "svc-daemon", Kind: ChangeRestart},
+				{Service: "svc-other", Kind: ChangeRestart},
+			},
+		},
+		{
+			name:    "global env overridden or not running",
+			profile: profile.Profile{Env: map[string]string{"A": "1"}, Services: map[string]profile.Service{"svc-daemon": {Env: map[string]string{"A": "2"}}}},
+			setup: func(t *testing.T) {
+				fakeService(t, "svc-daemon", started, true, true)
+				fakeService(t, "svc-other", &ServiceRecord{Desired: DesiredStopped}, true, false)
+			},
+			want: []Change{
+				{Service: GlobalEnv, Kind: ChangeEnv, Key: "A", To: "1"},
+				{Service: "svc-daemon", Kind: ChangeEnv, Key: "A", To: "2"},
+				{Service: "svc-daemon", Kind: ChangeRestart},
+			},
+		},
+		{
+			name:    "global env set by the service's env file",
+			profile: profile.Profile{Env: map[string]string{"A": "1"}, Services: map[string]profile.Service{"svc-daemon": {}}},
+			setup: func(t *testing.T) {
+				fakeService(t, "svc-daemon", started, true, true)
+				fakeService(t, "svc-other", started, true, true)
+				if err := os.WriteFile(config.ServiceEnvFile("svc-other"), []byte("A=3\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []Change{
+				{Service: GlobalEnv, Kind: ChangeEnv, Key: "A", To: "1"},
+				{Service: "svc-daemon", Kind: ChangeRestart},
+			},
+		},
+		{
+			name:    "absent",
+			profile: profile.Profile{Services: map[string]profile.Service{"svc-cli": {State: DesiredAbsent}}},
+			setup:   func(t *testing.T) { fakeService(t, "svc-cli", &ServiceRecord{Desired: DesiredStopped}, true, false) },
+			want:    []Change{{Service: "svc-cli", Kind: ChangeUninstall}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(config.GlobalEnvFile())
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+			plan, err := PlanProfile(&tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(plan.Changes, tt.want) {
+				t.Errorf("PlanProfile() =\n%v\nwant\n%v", plan.Changes, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+)
+
+// serviceCommand returns the expanded arguments and working directory
+// a service is started with, given the environment it will receive.
+func serviceCommand(svc *registry.Service, env []string) (args []string, dir string) {
+	for _, arg := range svc.Args {
+		args = append(args, expandVars(arg, svc.Name, env))
+	}
+
+	dir = config.ServiceDir(svc.Name)
+	if svc.WorkDir != "" {
+		wd := expandVars(svc.WorkDir, svc.Name, env)
+		if !filepath.IsAbs(wd) {
+			wd = filepath.Join(dir, wd)
+		}
+		dir = wd
+	}
+	return args, dir
+}
+
+// expandVars replaces ${VAR} and $VAR. SERVICE_DIR is the service directory,
+// HOME falls back to the orchestrator user's home, and anything else is
+// looked up in env. Unknown variables expand to "".
+func expandVars(s, name string, env []string) string {
+	return os.Expand(s, func(key string) string {
+		if key == "SERVICE_DIR" {
+			return config.ServiceDir(name)
+		}
+		if v, ok := lookupEnv(env, key); ok {
+			return v
+		}
+		if key == "HOME" {
+			return config.HomeDir()
+		}
+		return ""
+	})
+}
+
+// lookupEnv returns the last value of key in a KEY=VALUE list, as exec does.
+func lookupEnv(env []string, key string) (string, bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(env[i], "="); ok && k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// formatCommandLine renders a command line for display, quoting arguments
+// that would otherwise be ambiguous.
+func formatCommandLine(binary string, args []string) string {
+	parts := []string{quoteArg(binary)}
+	for _, arg := range args {
+		parts = append(parts, quoteArg(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+func quoteArg(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"'\\$") {
+		return strconv.Quote(s)
+	}
+	return s
+}
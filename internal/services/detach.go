@@ -0,0 +1,145 @@
+package services
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+)
+
+const (
+	// maxLogSize is the size a service log is rotated at.
+	maxLogSize   = 10 << 20
+	tailInterval = 250 * time.Millisecond
+)
+
+// Detached reports whether services outlive the orchestrator. Detached
+// services run in their own session and log to files; quitting or
+// self-updating the orchestrator leaves them running, and the next
+// orchestrator reattaches to them. Enabled from the tray or with
+// ORCHESTRATOR_DETACH=1.
+func Detached() bool {
+	if v, err := strconv.ParseBool(os.Getenv("ORCHESTRATOR_DETACH")); err == nil {
+		return v
+	}
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	loadState()
+	return state.Detach
+}
+
+// SetDetached turns detach mode on or off. It applies to services started
+// afterwards; services already running keep the mode they were started in.
+func SetDetached(on bool) error {
+	stateMu.Lock()
+	loadState()
+	state.Detach = on
+	stateMu.Unlock()
+	return SaveState()
+}
+
+// serviceLogFiles are the files a detached service writes stdout and stderr to.
+type serviceLogFiles struct {
+	stdout, stderr *os.File
+}
+
+// openServiceLogs opens a service's log files for appending, rotating
+// ones that have grown past maxLogSize.
+func openServiceLogs(name string) (*serviceLogFiles, error) {
+	open := func(path string) (*os.File, error) {
+		if info, err := os.Stat(path); err == nil && info.Size() > maxLogSize {
+			os.Rename(path, path+".1")
+		}
+		return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	}
+	stdout, err := open(config.ServiceLogFile(name))
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := open(config.ServiceErrLogFile(name))
+	if err != nil {
+		stdout.Close()
+		return nil, err
+	}
+	return &serviceLogFiles{stdout: stdout, stderr: stderr}, nil
+}
+
+func (l *serviceLogFiles) Close() {
+	l.stdout.Close()
+	l.stderr.Close()
+}
+
+// tailServiceLogs follows a service's log files from their current end
+// until stop is closed, feeding new lines into the service status. The
+// files are opened before it returns, so nothing written later is missed.
+func tailServiceLogs(name string, stop <-chan struct{}) {
+	for _, path := range []string{config.ServiceLogFile(name), config.ServiceErrLogFile(name)} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			continue
+		}
+		go tailLog(name, f, path == config.ServiceErrLogFile(name), stop)
+	}
+}
+
+func tailLog(name string, f *os.File, isStderr bool, stop <-chan struct{}) {
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var partial strings.Builder
+	stopping := false
+	for {
+		chunk, err := reader.ReadString('\n')
+		partial.WriteString(chunk)
+		if err == nil {
+			logLine(name, strings.TrimRight(partial.String(), "\r\n"), isStderr)
+			partial.Reset()
+			continue
+		}
+		if stopping {
+			// Everything written before the process exited has been read
+			if partial.Len() > 0 {
+				logLine(name, partial.String(), isStderr)
+			}
+			return
+		}
+		select {
+		case <-stop:
+			stopping = true
+		case <-time.After(tailInterval):
+			if rotateLog(f) {
+				reader.Reset(f)
+			}
+		}
+	}
+}
+
+// rotateLog copies a log that has grown past maxLogSize to its .1 file and
+// empties it, reporting whether it did. The service keeps the file open
+// for appending, so it goes on writing at the new end; a line written
+// between the copy and the truncation is lost.
+func rotateLog(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Size() <= maxLogSize {
+		return false
+	}
+	old, err := os.Create(f.Name() + ".1")
+	if err != nil {
+		return false
+	}
+	_, err = io.Copy(old, io.NewSectionReader(f, 0, info.Size()))
+	old.Close()
+	if err != nil || os.Truncate(f.Name(), 0) != nil {
+		return false
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return err == nil
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotateLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.log")
+	w, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w.Write(bytes.Repeat([]byte("x"), maxLogSize))
+	if rotateLog(f) {
+		t.Fatal("rotated a log of maxLogSize")
+	}
+	w.Write([]byte("\n"))
+	if !rotateLog(f) {
+		t.Fatal("didn't rotate a log past maxLogSize")
+	}
+	if info, err := os.Stat(path + ".1"); err != nil || info.Size() != maxLogSize+1 {
+		t.Errorf("rotated file = %v, %v, want %d bytes", info, err, maxLogSize+1)
+	}
+
+	// The service's next write lands at the start of the emptied file
+	w.Write([]byte("next\n"))
+	if data, _ := os.ReadFile(path); string(data) != "next\n" {
+		t.Errorf("log = %q, want %q", data, "next\n")
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package services
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess starts cmd in its own session so it outlives the
+// orchestrator and isn't hit by signals sent to its process group.
+func detachProcess(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+}
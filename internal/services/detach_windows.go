@@ -0,0 +1,19 @@
+//go:build windows
+
+package services
+
+import (
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// detachProcess starts cmd without the orchestrator's console, so closing
+// that console or pressing Ctrl+C in it doesn't take the service down.
+func detachProcess(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= windows.CREATE_NEW_PROCESS_GROUP | windows.DETACHED_PROCESS
+}
@@ -4,40 +4,182 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
-	"github.com/pink-tools/pink-core"
 	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/dotenv"
 	"github.com/pink-tools/pink-orchestrator/internal/registry"
+	"github.com/pink-tools/pink-orchestrator/internal/secrets"
 )
 
-func loadServiceEnv(name string) []string {
+// GlobalEnv names the shared env file applied to every service.
+const GlobalEnv = "global"
+
+// Sources of variables in a service environment, lowest precedence first.
+const (
+	EnvSourceSystem   = "system"
+	EnvSourceGlobal   = "global"
+	EnvSourceService  = "service"
+	EnvSourceOverride = "override"
+)
+
+// loadServiceEnv returns the environment for a service. Layers apply in
+// order of precedence: system < global.env < service .env < overrides.
+// Values in env files may reference variables from lower layers and keys
+// defined earlier in the same file.
+func loadServiceEnv(name string, overrides map[string]string) ([]string, error) {
+	env, _, err := buildServiceEnv(name, overrides)
+	return env, err
+}
+
+// buildServiceEnv is loadServiceEnv that also reports which layer set each
+// non-system variable.
+func buildServiceEnv(name string, overrides map[string]string) ([]string, map[string]string, error) {
 	env := appendPinkToolsToPath(getSystemEnv())
+	sources := make(map[string]string)
+	if config.UserMode() {
+		// pink-core publishes the IPC port next to $HOME's parent, which
+		// isn't writable without root
+		env = append(env, "HOME="+config.ServiceHome())
+	}
 
 	// Service name width for log alignment (children output JSON, orchestrator formats)
 	env = append(env, fmt.Sprintf("PINK_LOG_WIDTH=%d", registry.MaxServiceNameLen()))
 
-	envFile := config.ServiceEnvFile(name)
-	data, err := os.ReadFile(envFile)
+	layers := []struct{ source, file string }{
+		{EnvSourceGlobal, config.GlobalEnvFile()},
+		{EnvSourceService, config.ServiceEnvFile(name)},
+	}
+	for _, layer := range layers {
+		data, err := os.ReadFile(layer.file)
+		if err != nil {
+			continue
+		}
+		vars, err := dotenv.Parse(data, func(key string) (string, bool) {
+			return lookupEnv(env, key)
+		})
+		if err != nil {
+			return env, sources, fmt.Errorf("%s: %w", layer.file, err)
+		}
+		for _, v := range vars {
+			env = append(env, v.Key+"="+v.Value)
+			sources[v.Key] = layer.source
+		}
+	}
+
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+overrides[key])
+		sources[key] = EnvSourceOverride
+	}
+
+	return env, sources, nil
+}
+
+// ResolvedVar is one variable of a service's effective environment.
+type ResolvedVar struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// ResolveEnv returns the environment a service gets when started now, or is
+// running with, sorted by key. secret:// references are shown unresolved and
+// secret-typed values are masked unless reveal.
+func ResolveEnv(name string, reveal bool) ([]ResolvedVar, error) {
+	svc, err := registry.GetService(name)
 	if err != nil {
-		return env
+		return nil, err
 	}
+	runAs, err := lookupServiceUser(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.RLock()
+	var overrides map[string]string
+	if info, ok := runningProcesses[name]; ok {
+		overrides = info.overrides
+	}
+	mu.RUnlock()
+
+	env, sources, err := buildServiceEnv(name, overrides)
+	if err != nil {
+		return nil, err
+	}
+	env = runAs.environ(env, sources)
+	declared := declaredEnv(name)
 
-	for _, line := range strings.Split(string(data), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
+	values := make(map[string]string)
+	for _, e := range env {
+		key, value, _ := strings.Cut(e, "=")
+		values[key] = value
+	}
+
+	vars := make([]ResolvedVar, 0, len(values))
+	for key, value := range values {
+		source := sources[key]
+		if source == "" {
+			source = EnvSourceSystem
+		}
+		if declared[key].IsSecret() && !reveal && value != "" && !secrets.IsRef(value) {
+			value = secretMask
+		}
+		vars = append(vars, ResolvedVar{Key: key, Value: value, Source: source})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Key < vars[j].Key })
+	return vars, nil
+}
+
+// resolveSecrets replaces secret://<name> values with the stored secrets.
+// Only Start calls it, so resolved values never leave the spawned process.
+func resolveSecrets(env []string) ([]string, error) {
+	resolved := make([]string, len(env))
+	for i, e := range env {
+		key, value, _ := strings.Cut(e, "=")
+		if !secrets.IsRef(value) {
+			resolved[i] = e
+			continue
+		}
+		secret, err := secrets.Resolve(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		resolved[i] = key + "=" + secret
+	}
+	return resolved, nil
+}
+
+// checkServiceEnv enforces the registry's env var declarations against the
+// environment a service is about to receive, reporting every problem at once.
+func checkServiceEnv(svc *registry.Service, env []string, dir string) error {
+	var problems []string
+	for _, ev := range svc.EnvVars {
+		value, _ := lookupEnv(env, ev.Name)
+		if value == "" {
+			if ev.Required {
+				problems = append(problems, fmt.Sprintf("%s is required", ev.Name))
+			}
 			continue
 		}
-		if strings.Contains(line, "=") {
-			env = append(env, line)
+		if err := ev.Validate(value, dir); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", ev.Name, err))
 		}
 	}
 
-	return env
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid environment in %s: %s", config.ServiceEnvFile(svc.Name), strings.Join(problems, "; "))
+	}
+	return nil
 }
 
 func appendPinkToolsToPath(env []string) []string {
-	pinkToolsDir := core.PinkToolsDir()
+	pinkToolsDir := config.PinkToolsDir()
 	entries, err := os.ReadDir(pinkToolsDir)
 	if err != nil {
 		return env
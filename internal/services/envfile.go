@@ -0,0 +1,340 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/dotenv"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+	"github.com/pink-tools/pink-orchestrator/internal/secrets"
+)
+
+const secretMask = "********"
+
+var (
+	envMu    sync.Mutex
+	envKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+)
+
+// EnvEntry is a variable of a service .env file, or a registry-declared
+// variable that is not set yet.
+type EnvEntry struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Set         bool   `json:"set"`
+	Secret      bool   `json:"secret,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ListEnv returns the variables of a service .env (or global.env for
+// GlobalEnv) in file order, followed by
+// declared variables that are missing. Secret values are masked unless reveal.
+func ListEnv(name string, reveal bool) ([]EnvEntry, error) {
+	f, err := readEnvFile(name)
+	if err != nil {
+		return nil, err
+	}
+	declared := declaredEnv(name)
+
+	var entries []EnvEntry
+	seen := make(map[string]bool)
+	for _, v := range f.Vars() {
+		if seen[v.Key] {
+			continue
+		}
+		seen[v.Key] = true
+		value, _ := f.Get(v.Key)
+		entries = append(entries, envEntry(v.Key, value, true, declared[v.Key], reveal))
+	}
+	svc, err := registry.GetService(name)
+	if err == nil {
+		for _, ev := range svc.EnvVars {
+			if !seen[ev.Name] {
+				entries = append(entries, envEntry(ev.Name, "", false, ev, reveal))
+			}
+		}
+	}
+	return entries, nil
+}
+
+// GetEnv returns one variable of a service .env.
+func GetEnv(name, key string, reveal bool) (EnvEntry, error) {
+	f, err := readEnvFile(name)
+	if err != nil {
+		return EnvEntry{}, err
+	}
+	value, ok := f.Get(key)
+	if !ok {
+		return EnvEntry{}, fmt.Errorf("%s is not set for %s", key, name)
+	}
+	return envEntry(key, value, true, declaredEnv(name)[key], reveal), nil
+}
+
+// SetEnv assigns values in a service .env, validating declared variables first.
+func SetEnv(name string, values map[string]string) error {
+	declared := declaredEnv(name)
+	for key, value := range values {
+		if !envKeyRe.MatchString(key) {
+			return fmt.Errorf("invalid variable name: %q", key)
+		}
+		// References are validated once resolved, at Start
+		if ev, ok := declared[key]; ok && value != "" && !secrets.IsRef(value) {
+			if err := ev.Validate(value, serviceWorkDir(name)); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	return editEnvFile(name, func(f *dotenv.File) error {
+		for key, value := range values {
+			f.Set(key, value)
+		}
+		return nil
+	})
+}
+
+// UnsetEnv removes variables from a service .env.
+func UnsetEnv(name string, keys []string) error {
+	return editEnvFile(name, func(f *dotenv.File) error {
+		for _, key := range keys {
+			if !f.Unset(key) {
+				return fmt.Errorf("%s is not set for %s", key, name)
+			}
+		}
+		return nil
+	})
+}
+
+// ReadEnvContent returns a service .env verbatim, for editing.
+func ReadEnvContent(name string) (string, error) {
+	path, err := envFilePath(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+// WriteEnvContent replaces a service .env after checking it parses.
+func WriteEnvContent(name, content string) error {
+	path, err := envFilePath(name)
+	if err != nil {
+		return err
+	}
+	if _, err := dotenv.NewFile([]byte(content)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	envMu.Lock()
+	defer envMu.Unlock()
+	return writeEnvFile(path, []byte(content))
+}
+
+func envEntry(key, value string, set bool, ev registry.EnvVar, reveal bool) EnvEntry {
+	e := EnvEntry{
+		Key:         key,
+		Value:       value,
+		Set:         set,
+		Secret:      ev.IsSecret(),
+		Required:    ev.Required,
+		Description: ev.Description,
+	}
+	if e.Secret && !reveal && value != "" {
+		e.Value = secretMask
+	}
+	return e
+}
+
+func declaredEnv(name string) map[string]registry.EnvVar {
+	declared := make(map[string]registry.EnvVar)
+	if svc, err := registry.GetService(name); err == nil {
+		for _, ev := range svc.EnvVars {
+			declared[ev.Name] = ev
+		}
+	}
+	return declared
+}
+
+func serviceWorkDir(name string) string {
+	svc, err := registry.GetService(name)
+	if err != nil {
+		return filepath.Dir(config.ServiceEnvFile(name))
+	}
+	env, _ := loadServiceEnv(name, nil)
+	_, dir := serviceCommand(svc, env)
+	return dir
+}
+
+// envFilePath returns the .env of a registry service, or global.env for GlobalEnv.
+func envFilePath(name string) (string, error) {
+	if name == GlobalEnv {
+		return config.GlobalEnvFile(), nil
+	}
+	if _, err := registry.GetService(name); err != nil {
+		return "", err
+	}
+	return config.ServiceEnvFile(name), nil
+}
+
+func readEnvFile(name string) (*dotenv.File, error) {
+	envFile, err := envFilePath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(envFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	f, err := dotenv.NewFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", envFile, err)
+	}
+	return f, nil
+}
+
+func editEnvFile(name string, edit func(*dotenv.File) error) error {
+	envMu.Lock()
+	defer envMu.Unlock()
+
+	f, err := readEnvFile(name)
+	if err != nil {
+		return err
+	}
+	if err := edit(f); err != nil {
+		return err
+	}
+	path, _ := envFilePath(name)
+	return writeEnvFile(path, f.Bytes())
+}
+
+// writeEnvFile replaces path atomically. It keeps the mode and owner of an
+// existing file; new files are private to the user services run as.
+func writeEnvFile(path string, data []byte) error {
+	mode := os.FileMode(0600)
+	info, statErr := os.Stat(path)
+	if statErr == nil {
+		mode = info.Mode().Perm()
+	} else {
+		info = nil
+	}
+
+	tmpFile := path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	chownLike(tmpFile, info)
+	if err := os.Rename(tmpFile, path); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	return nil
+}
+
+// envTemplate returns the .env lines describing a declared variable: its
+// description, then either its default or a commented-out placeholder.
+func envTemplate(ev registry.EnvVar) []string {
+	var lines []string
+	if ev.Description != "" {
+		lines = append(lines, "# "+ev.Description)
+	}
+	if ev.Default != "" {
+		lines = append(lines, ev.Name+"="+dotenv.Quote(ev.Default))
+	} else {
+		lines = append(lines, "# "+ev.Name+"=")
+	}
+	return lines
+}
+
+// syncEnvTemplate creates the service .env from the registry declarations, or
+// appends variables declared since the file was written. Variables the
+// registry no longer declares are reported but left in place. A dry run
+// reports the changes without writing.
+func syncEnvTemplate(svc *registry.Service, progress func(string), dryRun bool) error {
+	envMu.Lock()
+	defer envMu.Unlock()
+
+	envFile := config.ServiceEnvFile(svc.Name)
+	data, err := os.ReadFile(envFile)
+	if os.IsNotExist(err) {
+		if dryRun {
+			progress(fmt.Sprintf("Would create %s with %d declared variables", envFile, len(svc.EnvVars)))
+			return nil
+		}
+		f, _ := dotenv.NewFile(nil)
+		for _, ev := range svc.EnvVars {
+			f.Append(envTemplate(ev)...)
+		}
+		if err := writeEnvFile(envFile, f.Bytes()); err != nil {
+			return fmt.Errorf("failed to write .env file: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read .env file: %w", err)
+	}
+
+	// Older installs wrote .env world-readable and owned by root; hand it to
+	// the service user so CLI services can still read it
+	if info, err := os.Stat(envFile); err == nil && info.Mode().Perm()&0077 != 0 {
+		if dryRun {
+			progress("Would restrict .env permissions to its owner")
+		} else {
+			chownLike(envFile, nil)
+			if err := os.Chmod(envFile, 0600); err == nil {
+				progress("Restricted .env permissions to its owner")
+			}
+		}
+	}
+
+	f, err := dotenv.NewFile(data)
+	if err != nil {
+		// Don't touch a file we can't parse; Start reports the error
+		progress(fmt.Sprintf("Warning: .env not updated: %v", err))
+		return nil
+	}
+
+	var added []string
+	declared := make(map[string]bool)
+	for _, ev := range svc.EnvVars {
+		declared[ev.Name] = true
+		if f.Mentions(ev.Name) {
+			continue
+		}
+		if len(added) == 0 {
+			f.Append("")
+		}
+		f.Append(envTemplate(ev)...)
+		added = append(added, ev.Name)
+
+		msg := fmt.Sprintf("Added %s to .env", ev.Name)
+		if dryRun {
+			msg = fmt.Sprintf("Would add %s to .env", ev.Name)
+		}
+		if ev.Default == "" && ev.Required {
+			msg += " (required, please set)"
+		}
+		progress(msg)
+	}
+
+	for _, v := range f.Vars() {
+		if !declared[v.Key] {
+			progress(fmt.Sprintf("Note: %s in .env is not declared by %s (removed or custom)", v.Key, svc.Name))
+			declared[v.Key] = true // report once
+		}
+	}
+
+	if len(added) == 0 || dryRun {
+		return nil
+	}
+	if err := writeEnvFile(envFile, f.Bytes()); err != nil {
+		return fmt.Errorf("failed to update .env file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package services
+
+import (
+	"os"
+	"syscall"
+)
+
+// exitSignal names the signal that killed a process, or "".
+func exitSignal(state *os.ProcessState) string {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal().String()
+	}
+	return ""
+}
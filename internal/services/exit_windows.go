@@ -0,0 +1,10 @@
+//go:build windows
+
+package services
+
+import "os"
+
+// exitSignal is always "" on Windows, which has no signals.
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
@@ -0,0 +1,405 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+	"github.com/pink-tools/pink-orchestrator/internal/secrets"
+)
+
+// exportFormat is the layout version of export archives.
+const exportFormat = 1
+
+// Archive members.
+const (
+	manifestMember = "manifest.json"
+	stateMember    = "state.json"
+	overlayMember  = "registry.local.yaml"
+	secretsMember  = "secrets.json"   // in plain text
+	sealedMember   = "secrets.sealed" // encrypted with a passphrase
+	envMemberDir   = "env/"
+)
+
+// How an export treats secrets.
+const (
+	SecretsInclude = "include" // in plain text
+	SecretsEncrypt = "encrypt" // sealed with a passphrase
+	SecretsExclude = "exclude" // left out
+)
+
+// Manifest describes an export archive.
+type Manifest struct {
+	Format       int       `json:"format"`
+	Created      time.Time `json:"created"`
+	Orchestrator string    `json:"orchestrator"`
+	Platform     string    `json:"platform"`
+	Secrets      string    `json:"secrets"`
+}
+
+// exportedSecrets are the secret values of an export: the store, and the
+// values of secret variables set directly in .env files, which are blanked
+// in the exported files.
+type exportedSecrets struct {
+	Store map[string]string            `json:"store,omitempty"`
+	Env   map[string]map[string]string `json:"env,omitempty"` // by service
+}
+
+// Export archives the state file, registry overlay and env files as a
+// tar.gz. Secrets are handled as mode says; SecretsEncrypt needs a passphrase.
+func Export(mode, passphrase string) ([]byte, error) {
+	switch mode {
+	case SecretsInclude, SecretsExclude:
+	case SecretsEncrypt:
+		if passphrase == "" {
+			return nil, fmt.Errorf("a passphrase is required to encrypt secrets")
+		}
+	default:
+		return nil, fmt.Errorf("unknown secrets mode: %s", mode)
+	}
+
+	now := time.Now()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	manifest, _ := json.MarshalIndent(Manifest{
+		Format:       exportFormat,
+		Created:      now,
+		Orchestrator: orchestratorVersion,
+		Platform:     config.Platform(),
+		Secrets:      mode,
+	}, "", "  ")
+	if err := add(manifestMember, manifest); err != nil {
+		return nil, err
+	}
+
+	stateMu.Lock()
+	loadState()
+	stateData, err := json.MarshalIndent(state, "", "  ")
+	stateMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := add(stateMember, stateData); err != nil {
+		return nil, err
+	}
+
+	overlay, err := os.ReadFile(config.RegistryOverlayFile())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := add(overlayMember, overlay); err != nil {
+			return nil, err
+		}
+	}
+
+	names := []string{GlobalEnv}
+	if svcs, err := registry.ListServices(); err == nil {
+		for _, svc := range svcs {
+			names = append(names, svc.Name)
+		}
+	}
+	sec := exportedSecrets{Env: make(map[string]map[string]string)}
+	for _, name := range names {
+		data, values, err := exportEnv(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if data == nil {
+			continue
+		}
+		if err := add(envMemberDir+name+".env", data); err != nil {
+			return nil, err
+		}
+		if len(values) > 0 {
+			sec.Env[name] = values
+		}
+	}
+
+	if mode != SecretsExclude {
+		if sec.Store, err = secrets.Values(); err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(sec, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		member := secretsMember
+		if mode == SecretsEncrypt {
+			member = sealedMember
+			if data, err = secrets.Seal(data, passphrase); err != nil {
+				return nil, err
+			}
+		}
+		if err := add(member, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// exportEnv returns the env file of name with secret values blanked, and
+// those values, or nil data when the file doesn't exist.
+func exportEnv(name string) ([]byte, map[string]string, error) {
+	envMu.Lock()
+	defer envMu.Unlock()
+
+	path, err := envFilePath(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	f, err := readEnvFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	declared := declaredEnv(name)
+	values := make(map[string]string)
+	for _, v := range f.Vars() {
+		value, _ := f.Get(v.Key)
+		if value == "" || !declared[v.Key].IsSecret() || secrets.IsRef(value) {
+			continue
+		}
+		values[v.Key] = value
+		f.Set(v.Key, "")
+	}
+	return f.Bytes(), values, nil
+}
+
+// ReadManifest returns the manifest of an export archive.
+func ReadManifest(archive []byte) (Manifest, error) {
+	members, err := readArchive(archive)
+	if err != nil {
+		return Manifest{}, err
+	}
+	return manifestOf(members)
+}
+
+func manifestOf(members map[string][]byte) (Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(members[manifestMember], &m); err != nil {
+		return m, fmt.Errorf("not an orchestrator export")
+	}
+	return m, nil
+}
+
+// Import restores an export archive: the registry overlay, secrets, env
+// files and each service's desired state and pin, reinstalling the
+// recorded versions. passphrase opens encrypted secrets. Services are
+// imported one by one; a failure is reported after the rest are done.
+func Import(archive []byte, passphrase string, progress func(string)) error {
+	members, err := readArchive(archive)
+	if err != nil {
+		return err
+	}
+	m, err := manifestOf(members)
+	if err != nil {
+		return err
+	}
+	if m.Format > exportFormat {
+		return fmt.Errorf("archive format %d is newer than supported %d", m.Format, exportFormat)
+	}
+
+	imported := &State{}
+	if err := json.Unmarshal(members[stateMember], imported); err != nil {
+		return fmt.Errorf("invalid state in archive: %w", err)
+	}
+	if imported.Version > stateVersion {
+		return fmt.Errorf("archive state version %d is newer than supported %d", imported.Version, stateVersion)
+	}
+	if err := migrateState(imported); err != nil {
+		return fmt.Errorf("invalid state in archive: %w", err)
+	}
+
+	var sec exportedSecrets
+	data, ok := members[secretsMember]
+	if sealed, isSealed := members[sealedMember]; isSealed {
+		if passphrase == "" {
+			return fmt.Errorf("the archive's secrets are encrypted: a passphrase is required")
+		}
+		if data, err = secrets.Open(sealed, passphrase); err != nil {
+			return err
+		}
+		ok = true
+	}
+	if ok {
+		if err := json.Unmarshal(data, &sec); err != nil {
+			return fmt.Errorf("invalid secrets in archive: %w", err)
+		}
+	}
+
+	if overlay, ok := members[overlayMember]; ok {
+		if _, err := registry.ParseOverlay(overlay); err != nil {
+			return fmt.Errorf("invalid registry overlay in archive: %w", err)
+		}
+	}
+
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+
+	progress(fmt.Sprintf("archive of %s exported %s", m.Platform, m.Created.Local().Format("2006-01-02 15:04")))
+
+	if overlay, ok := members[overlayMember]; ok {
+		if err := os.WriteFile(config.RegistryOverlayFile(), overlay, 0644); err != nil {
+			return fmt.Errorf("failed to restore registry overlay: %w", err)
+		}
+		progress("registry overlay restored")
+	}
+	for name, value := range sec.Store {
+		if err := secrets.Set(name, value); err != nil {
+			return fmt.Errorf("failed to restore secret %s: %w", name, err)
+		}
+	}
+	if len(sec.Store) > 0 {
+		progress(fmt.Sprintf("%d secrets restored", len(sec.Store)))
+	}
+	if err := SetDetached(imported.Detach); err != nil {
+		return err
+	}
+
+	var errs []error
+	if err := importEnv(GlobalEnv, members[envMemberDir+GlobalEnv+".env"], sec.Env[GlobalEnv]); err != nil {
+		errs = append(errs, fmt.Errorf("global env: %w", err))
+	}
+
+	names := make([]string, 0, len(imported.Services))
+	for name := range imported.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rec := imported.Services[name]
+		if rec.Desired == "" {
+			continue
+		}
+		err := importService(name, rec, members[envMemberDir+name+".env"], sec.Env[name], progress)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// importService records a service's desired state and pin, installs its
+// recorded version, restores its env file and then starts or stops it.
+func importService(name string, rec *ServiceRecord, env []byte, values map[string]string, progress func(string)) error {
+	svc, err := registry.GetService(name)
+	if err != nil {
+		return err
+	}
+	if !svc.Supports(config.Platform()) {
+		return fmt.Errorf("not available for %s", config.Platform())
+	}
+	updateRecord(name, func(r *ServiceRecord) {
+		r.Desired = rec.Desired
+		r.Pin = rec.Pin
+	})
+	if rec.Desired == DesiredAbsent {
+		return converge(name, "import", progress, ActionUninstall)
+	}
+
+	serviceProgress := func(msg string) { progress(fmt.Sprintf("%s: %s", name, msg)) }
+	switch installed := GetInstalledVersion(name); {
+	case !IsInstalled(name):
+		version := rec.Version
+		if version == "" {
+			version = "latest"
+		}
+		err = InstallVersion(name, rec.Version, serviceProgress)
+		logApplyEvent(name, ActionInstall, "import: recorded "+version, err)
+	case rec.Version != "" && !sameVersion(installed, rec.Version):
+		err = (&installer{progress: serviceProgress}).replace(name, rec.Version)
+		logApplyEvent(name, ActionUpdate, fmt.Sprintf("import: installed %s, recorded %s", installed, rec.Version), err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := importEnv(name, env, values); err != nil {
+		return err
+	}
+	if env != nil {
+		progress(fmt.Sprintf("%s: env restored", name))
+	}
+	return converge(name, "import", progress, ActionStart, ActionStop)
+}
+
+// importEnv replaces the env file of name with data and sets the secret
+// values blanked on export.
+func importEnv(name string, data []byte, values map[string]string) error {
+	if data != nil {
+		path, err := envFilePath(name)
+		if err != nil {
+			return err
+		}
+		envMu.Lock()
+		err = writeEnvFile(path, data)
+		envMu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	if len(values) > 0 {
+		return SetEnv(name, values)
+	}
+	return nil
+}
+
+// readArchive returns the members of a tar.gz archive by name.
+func readArchive(archive []byte) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("not an orchestrator export: %w", err)
+	}
+	defer gz.Close()
+
+	members := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("corrupt archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || strings.Contains(hdr.Name, "..") {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt archive: %w", err)
+		}
+		members[hdr.Name] = data
+	}
+	return members, nil
+}
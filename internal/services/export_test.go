@@ -0,0 +1,167 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/secrets"
+)
+
+const testOverlay = "services:\n  svc-cli:\n    args: [\"--quiet\"]\n"
+
+// setupExport gives the machine what an export carries: a secret, the
+// registry overlay, the global env and a service with a secret env value.
+func setupExport(t *testing.T) {
+	t.Helper()
+	fakeService(t, "svc-cli", &ServiceRecord{Desired: DesiredStopped}, true, false)
+	if err := secrets.Set("token", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.RegistryOverlayFile(), []byte(testOverlay), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetEnv(GlobalEnv, map[string]string{"LOG_LEVEL": "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetEnv("svc-cli", map[string]string{"API_KEY": "plain-key", "REGION": "eu"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wipeExported removes what setupExport created, as on a new machine.
+func wipeExported(t *testing.T) {
+	t.Helper()
+	for _, path := range []string{
+		config.SecretsFile(), config.SecretKeyFile(), config.RegistryOverlayFile(),
+		config.GlobalEnvFile(), config.ServiceEnvFile("svc-cli"),
+	} {
+		os.Remove(path)
+	}
+	stateMu.Lock()
+	delete(state.Services, "svc-cli")
+	stateMu.Unlock()
+}
+
+func TestExportImport(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		passphrase string // for the export
+		open       string // for the import
+		member     string // holding the secrets, if any
+		wantErr    bool
+		secrets    bool // restored
+	}{
+		{"encrypted", SecretsEncrypt, "pass", "pass", sealedMember, false, true},
+		{"wrong passphrase", SecretsEncrypt, "pass", "nope", sealedMember, true, false},
+		{"no passphrase", SecretsEncrypt, "pass", "", sealedMember, true, false},
+		{"plain", SecretsInclude, "", "", secretsMember, false, true},
+		{"excluded", SecretsExclude, "", "", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupExport(t)
+			t.Cleanup(func() { wipeExported(t) })
+
+			archive, err := Export(tt.mode, tt.passphrase)
+			if err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			members, err := readArchive(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, member := range []string{secretsMember, sealedMember} {
+				if _, ok := members[member]; ok != (member == tt.member) {
+					t.Errorf("archive has %s: %v, want %v", member, ok, member == tt.member)
+				}
+			}
+			if env := string(members[envMemberDir+"svc-cli.env"]); strings.Contains(env, "plain-key") {
+				t.Errorf("exported env file carries the secret value:\n%s", env)
+			}
+			if tt.mode == SecretsEncrypt && bytes.Contains(members[sealedMember], []byte("s3cret")) {
+				t.Error("sealed secrets are readable")
+			}
+
+			wipeExported(t)
+			err = Import(archive, tt.open, func(string) {})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Import() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if _, statErr := os.Stat(config.RegistryOverlayFile()); statErr == nil {
+					t.Error("a failed import restored the overlay")
+				}
+				return
+			}
+
+			if overlay, _ := os.ReadFile(config.RegistryOverlayFile()); string(overlay) != testOverlay {
+				t.Errorf("overlay = %q, want %q", overlay, testOverlay)
+			}
+			if rec := Record("svc-cli"); rec == nil || rec.Desired != DesiredStopped {
+				t.Errorf("svc-cli record = %+v, want desired %s", rec, DesiredStopped)
+			}
+			checkEnv(t, GlobalEnv, "LOG_LEVEL", "debug")
+			checkEnv(t, "svc-cli", "REGION", "eu")
+
+			wantKey, wantToken := "", ""
+			if tt.secrets {
+				wantKey, wantToken = "plain-key", "s3cret"
+			}
+			checkEnv(t, "svc-cli", "API_KEY", wantKey)
+			if token, _ := secrets.Resolve(secrets.Prefix + "token"); token != wantToken {
+				t.Errorf("secret token = %q, want %q", token, wantToken)
+			}
+		})
+	}
+}
+
+func TestImportRejectsInvalidOverlay(t *testing.T) {
+	setupExport(t)
+	t.Cleanup(func() { wipeExported(t) })
+	archive, err := Export(SecretsExclude, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, err := readArchive(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members[overlayMember] = []byte("services:\n  svc-cli:\n    bogus: 1\n")
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range members {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data))})
+		tw.Write(data)
+	}
+	tw.Close()
+	gz.Close()
+
+	wipeExported(t)
+	if err := Import(buf.Bytes(), "", func(string) {}); err == nil {
+		t.Fatal("Import() accepted an overlay with an unknown field")
+	}
+	if _, err := os.Stat(config.RegistryOverlayFile()); err == nil {
+		t.Error("the invalid overlay was written")
+	}
+}
+
+// checkEnv fails t unless name's env file sets key to want, or leaves it
+// empty when want is.
+func checkEnv(t *testing.T, name, key, want string) {
+	t.Helper()
+	f, err := readEnvFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := f.Get(key); got != want {
+		t.Errorf("%s: %s = %q, want %q", name, key, got, want)
+	}
+}
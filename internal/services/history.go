@@ -0,0 +1,164 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+)
+
+const (
+	// stderrTailLines is how many stderr lines a run record keeps.
+	stderrTailLines = 20
+	// historyLimit is how many runs are kept per service.
+	historyLimit = 100
+)
+
+// Run outcomes.
+const (
+	ExitStopped = "stopped" // stopped by the orchestrator
+	ExitClean   = "exited"  // exited on its own with status 0
+	ExitCrashed = "crashed" // non-zero status or killed by a signal
+	ExitFailed  = "failed"  // never started
+	ExitUnknown = "unknown" // adopted, so the status couldn't be collected
+)
+
+// RunRecord is one start and exit of a service.
+type RunRecord struct {
+	Started  time.Time `json:"started"`
+	Exited   time.Time `json:"exited"`
+	PID      int       `json:"pid,omitempty"`
+	Outcome  string    `json:"outcome"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Signal   string    `json:"signal,omitempty"`
+	Duration float64   `json:"duration"` // seconds
+	Error    string    `json:"error,omitempty"`
+	Stderr   []string  `json:"stderr,omitempty"` // last lines before the exit
+}
+
+var (
+	historyMu   sync.Mutex
+	stderrTails = make(map[string][]string) // guarded by mu
+)
+
+// recordStderr keeps the latest stderr lines of a running service.
+func recordStderr(name, line string) {
+	mu.Lock()
+	tail := append(stderrTails[name], line)
+	if len(tail) > stderrTailLines {
+		tail = tail[len(tail)-stderrTailLines:]
+	}
+	stderrTails[name] = tail
+	mu.Unlock()
+}
+
+// takeStderr returns and clears the stderr tail of a service.
+func takeStderr(name string) []string {
+	mu.Lock()
+	defer mu.Unlock()
+	tail := stderrTails[name]
+	delete(stderrTails, name)
+	return tail
+}
+
+// recordExit completes a run record from how the process ended and
+// appends it to the service history.
+func recordExit(name string, rec RunRecord, state *os.ProcessState, waitErr error, stopping bool) {
+	rec.Exited = time.Now()
+	rec.Duration = rec.Exited.Sub(rec.Started).Seconds()
+	rec.Stderr = takeStderr(name)
+
+	switch {
+	case stopping:
+		rec.Outcome = ExitStopped
+	case state == nil:
+		rec.Outcome = ExitUnknown
+	case state.Success():
+		rec.Outcome = ExitClean
+	default:
+		rec.Outcome = ExitCrashed
+	}
+	if state != nil {
+		if sig := exitSignal(state); sig != "" {
+			rec.Signal = sig
+		} else {
+			code := state.ExitCode()
+			rec.ExitCode = &code
+		}
+	}
+	if waitErr != nil && rec.Outcome != ExitStopped {
+		rec.Error = waitErr.Error()
+	}
+	if rec.Outcome == ExitCrashed {
+		updateRecord(name, func(r *ServiceRecord) { r.Crashes++ })
+	}
+
+	appendHistory(name, rec)
+}
+
+// recordStartFailure adds a run that never got going.
+func recordStartFailure(name string, err error) {
+	now := time.Now()
+	appendHistory(name, RunRecord{
+		Started: now,
+		Exited:  now,
+		Outcome: ExitFailed,
+		Error:   err.Error(),
+		Stderr:  takeStderr(name),
+	})
+}
+
+func historyFile(name string) string {
+	return filepath.Join(config.HistoryDir(), name+".jsonl")
+}
+
+func appendHistory(name string, rec RunRecord) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	appendJSONLine(historyFile(name), rec, historyLimit)
+}
+
+// History returns the recorded runs of a service, newest first, at most
+// limit of them when limit > 0.
+func History(name string, limit int) ([]RunRecord, error) {
+	if _, err := registry.GetService(name); err != nil {
+		return nil, err
+	}
+
+	historyMu.Lock()
+	lines, err := readJSONLines(historyFile(name))
+	historyMu.Unlock()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	var runs []RunRecord
+	for i := len(lines) - 1; i >= 0; i-- {
+		var rec RunRecord
+		if err := json.Unmarshal(lines[i], &rec); err != nil {
+			continue
+		}
+		runs = append(runs, rec)
+		if limit > 0 && len(runs) == limit {
+			break
+		}
+	}
+	return runs, nil
+}
+
+// LastExit returns the most recent run of a service, or nil.
+func LastExit(name string) *RunRecord {
+	runs, err := History(name, 1)
+	if err != nil || len(runs) == 0 {
+		return nil
+	}
+	return &runs[0]
+}
@@ -12,93 +12,136 @@ import (
 	"strings"
 	"time"
 
-	"github.com/pink-tools/pink-core"
 	"github.com/pink-tools/pink-otel"
 	"github.com/pink-tools/pink-orchestrator/internal/config"
 	"github.com/pink-tools/pink-orchestrator/internal/registry"
+	"golang.org/x/term"
 )
 
+// installer carries out an install or update. A dry run walks the same
+// steps and reports each action it would take instead of taking it.
+type installer struct {
+	progress func(string)
+	dryRun   bool
+	walked   map[string]bool // services a dry run already installed
+}
+
+func (in *installer) would(format string, args ...any) {
+	in.progress("Would " + fmt.Sprintf(format, args...))
+}
+
 func Install(name string, progress func(string)) error {
-	mu.Lock()
-	if installingServices[name] {
-		mu.Unlock()
-		return fmt.Errorf("already installing")
-	}
-	installingServices[name] = true
-	mu.Unlock()
+	return InstallVersion(name, "", progress)
+}
 
-	defer func() {
+// InstallVersion installs the release tagged version, or the latest
+// release when version is empty.
+func InstallVersion(name, version string, progress func(string)) error {
+	return (&installer{progress: progress}).install(name, version)
+}
+
+// InstallDryRun reports what InstallVersion would do.
+func InstallDryRun(name, version string, progress func(string)) error {
+	return (&installer{progress: progress, dryRun: true}).install(name, version)
+}
+
+func (in *installer) install(name, version string) error {
+	progress := in.progress
+	if in.dryRun {
+		if in.walked == nil {
+			in.walked = make(map[string]bool)
+		}
+		in.walked[name] = true
+	} else {
 		mu.Lock()
-		delete(installingServices, name)
-		mu.Unlock()
-		if onStatusUpdate != nil {
-			onStatusUpdate()
+		if installingServices[name] {
+			mu.Unlock()
+			return fmt.Errorf("already installing")
 		}
-	}()
+		installingServices[name] = true
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			delete(installingServices, name)
+			mu.Unlock()
+			if onStatusUpdate != nil {
+				onStatusUpdate()
+			}
+		}()
+	}
 
 	svc, err := registry.GetService(name)
 	if err != nil {
 		return err
 	}
 
+	if !svc.Supports(config.Platform()) {
+		return fmt.Errorf("%s is not available for %s", name, config.Platform())
+	}
+
 	for _, dep := range svc.Dependencies {
-		if !IsInstalled(dep) {
+		if !IsInstalled(dep) && !in.walked[dep] {
 			progress(fmt.Sprintf("Installing dependency: %s", dep))
-			if err := Install(dep, progress); err != nil {
+			if err := in.install(dep, ""); err != nil {
 				return fmt.Errorf("failed to install dependency %s: %w", dep, err)
 			}
 		}
 	}
 
 	if len(svc.SystemDeps) > 0 {
-		if err := installSystemDeps(svc.SystemDeps, progress); err != nil {
+		if err := in.installSystemDeps(svc.SystemDeps); err != nil {
 			return fmt.Errorf("failed to install system deps: %w", err)
 		}
 	}
 
-	progress(fmt.Sprintf("Downloading %s...", name))
-
-	if err := os.MkdirAll(core.ServiceDir(name), 0755); err != nil {
-		return fmt.Errorf("failed to create service directory: %w", err)
+	releaseURL := fmt.Sprintf("https://github.com/%s/releases/latest/download/%s", svc.Repo, svc.BinaryAsset())
+	if version != "" {
+		releaseURL = fmt.Sprintf("https://github.com/%s/releases/download/%s/%s", svc.Repo, version, svc.BinaryAsset())
 	}
-
-	releaseURL := fmt.Sprintf("https://github.com/%s/releases/latest/download/%s", svc.Repo, config.BinaryName(name))
 	binaryPath := config.ServiceBinary(name)
 
-	if err := downloadFile(releaseURL, binaryPath, progress); err != nil {
-		return fmt.Errorf("failed to download binary: %w", err)
-	}
+	if in.dryRun {
+		in.would("download %s to %s", releaseURL, binaryPath)
+		for _, asset := range svc.ExtraAssets {
+			in.would("download %s to %s", asset.URL, filepath.Join(config.ServiceDir(name), asset.Path))
+		}
+	} else {
+		progress(fmt.Sprintf("Downloading %s...", name))
 
-	if err := os.Chmod(binaryPath, 0755); err != nil {
-		return fmt.Errorf("failed to make binary executable: %w", err)
-	}
+		if err := os.MkdirAll(config.ServiceDir(name), 0755); err != nil {
+			return fmt.Errorf("failed to create service directory: %w", err)
+		}
 
-	for _, asset := range svc.ExtraAssets {
-		progress(fmt.Sprintf("Downloading %s...", asset.Path))
-		assetPath := filepath.Join(core.ServiceDir(name), asset.Path)
-		if err := downloadFile(asset.URL, assetPath, progress); err != nil {
-			return fmt.Errorf("failed to download asset %s: %w", asset.Path, err)
+		if err := downloadFile(releaseURL, binaryPath, progress); err != nil {
+			return fmt.Errorf("failed to download binary: %w", err)
 		}
-	}
 
-	envFile := config.ServiceEnvFile(name)
-	if _, err := os.Stat(envFile); os.IsNotExist(err) {
-		var envContent strings.Builder
-		for _, ev := range svc.EnvVars {
-			if ev.Default != "" {
-				envContent.WriteString(fmt.Sprintf("%s=%s\n", ev.Name, ev.Default))
-			} else {
-				envContent.WriteString(fmt.Sprintf("# %s=\n", ev.Name))
-			}
+		if err := os.Chmod(binaryPath, 0755); err != nil {
+			return fmt.Errorf("failed to make binary executable: %w", err)
 		}
-		if err := os.WriteFile(envFile, []byte(envContent.String()), 0644); err != nil {
-			return fmt.Errorf("failed to write .env file: %w", err)
+
+		for _, asset := range svc.ExtraAssets {
+			progress(fmt.Sprintf("Downloading %s...", asset.Path))
+			assetPath := filepath.Join(config.ServiceDir(name), asset.Path)
+			if err := downloadFile(asset.URL, assetPath, progress); err != nil {
+				return fmt.Errorf("failed to download asset %s: %w", asset.Path, err)
+			}
 		}
 	}
 
-	createSymlink(name, progress)
+	if err := syncEnvTemplate(svc, progress, in.dryRun); err != nil {
+		return err
+	}
+
+	in.createSymlink(name)
 
-	installClaudeMd(svc, progress)
+	in.installClaudeMd(svc)
+
+	if in.dryRun {
+		in.would("check %s --version", binaryPath)
+		return nil
+	}
 
 	// Verify binary works before saving version
 	if err := verifyBinary(binaryPath); err != nil {
@@ -107,11 +150,19 @@ func Install(name string, progress func(string)) error {
 	}
 
 	// Get version from binary for progress message
-	if version := GetInstalledVersion(name); version != "" {
-		progress(fmt.Sprintf("%s installed (%s)", name, version))
+	installed := GetInstalledVersion(name)
+	if installed != "" {
+		progress(fmt.Sprintf("%s installed (%s)", name, installed))
 	} else {
 		progress(fmt.Sprintf("%s installed", name))
 	}
+	updateRecord(name, func(rec *ServiceRecord) {
+		rec.Version = installed
+		rec.InstalledAt = time.Now()
+		if rec.Desired == "" || rec.Desired == DesiredAbsent {
+			rec.Desired = DesiredStopped
+		}
+	})
 
 	return nil
 }
@@ -130,26 +181,83 @@ func verifyBinary(path string) error {
 }
 
 func Update(name string, progress func(string)) error {
+	return (&installer{progress: progress}).update(name)
+}
+
+// UpdateDryRun reports what Update would do.
+func UpdateDryRun(name string, progress func(string)) error {
+	return (&installer{progress: progress, dryRun: true}).update(name)
+}
+
+func (in *installer) update(name string) error {
+	progress := in.progress
 	progress("Checking for updates...")
-	hasUpdate, oldVersion, latest, err := CheckUpdate(name)
+	hasUpdate, oldVersion, latest, err := checkUpdate(name, !in.dryRun)
 	if err != nil {
 		return fmt.Errorf("failed to check update: %w", err)
 	}
 	if !hasUpdate {
-		progress("Already up to date")
+		if rec := Record(name); rec != nil && rec.Pin != "" {
+			progress(fmt.Sprintf("Pinned at %s, not updating", rec.Pin))
+		} else {
+			progress("Already up to date")
+		}
 		return nil
 	}
 
+	if in.dryRun {
+		progress(fmt.Sprintf("Update available: %s → %s", oldVersion, latest))
+	}
+	if err := in.replace(name, ""); err != nil {
+		return err
+	}
+	if !in.dryRun {
+		progress(fmt.Sprintf("Updated: %s → %s", oldVersion, latest))
+	}
+	return nil
+}
+
+// replace installs version (latest when empty) over an installed service,
+// stopping it for the swap and starting it again if it was running.
+func (in *installer) replace(name, version string) error {
+	progress := in.progress
 	wasRunning := GetStatus(name).Status == StatusRunning
+	binaryPath := config.ServiceBinary(name)
+
+	if in.dryRun {
+		if wasRunning {
+			in.would("stop %s", name)
+		}
+		in.would("move %s to %s.old", binaryPath, binaryPath)
+		if err := in.install(name, version); err != nil {
+			return err
+		}
+		if wasRunning {
+			in.would("start %s", name)
+		}
+		return nil
+	}
+
+	mu.Lock()
+	if updatingServices[name] {
+		mu.Unlock()
+		return fmt.Errorf("already updating")
+	}
+	updatingServices[name] = true
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		delete(updatingServices, name)
+		mu.Unlock()
+	}()
+
 	if wasRunning {
 		progress("Stopping service...")
-		if err := Stop(name); err != nil {
+		if err := stop(name); err != nil {
 			return fmt.Errorf("failed to stop service: %w", err)
 		}
 	}
 
-	binaryPath := config.ServiceBinary(name)
-
 	// Rename-first strategy: rename old binary before installing new
 	// This works reliably on Windows even without sleep
 	if IsInstalled(name) {
@@ -161,12 +269,10 @@ func Update(name string, progress func(string)) error {
 		defer os.Remove(oldPath) // cleanup after success
 	}
 
-	if err := Install(name, progress); err != nil {
+	if err := in.install(name, version); err != nil {
 		return err
 	}
 
-	progress(fmt.Sprintf("Updated: %s → %s", oldVersion, latest))
-
 	if wasRunning {
 		progress("Restarting service...")
 		if err := Start(name); err != nil {
@@ -178,16 +284,33 @@ func Update(name string, progress func(string)) error {
 }
 
 func Uninstall(name string) error {
-	if err := Stop(name); err != nil {
+	if err := stop(name); err != nil {
 		return fmt.Errorf("failed to stop service: %w", err)
 	}
 
 	if runtime.GOOS != "windows" {
-		linkPath := filepath.Join("/usr/local/bin", name)
+		linkPath := filepath.Join(config.BinDir(), name)
 		os.Remove(linkPath)
 	}
 
-	return os.Remove(config.ServiceBinary(name))
+	if err := os.Remove(config.ServiceBinary(name)); err != nil {
+		return err
+	}
+	updateRecord(name, func(rec *ServiceRecord) {
+		*rec = ServiceRecord{Desired: DesiredAbsent}
+	})
+	return nil
+}
+
+// uninstall reports what Uninstall would do.
+func (in *installer) uninstall(name string) {
+	if GetStatus(name).Status == StatusRunning {
+		in.would("stop %s", name)
+	}
+	if runtime.GOOS != "windows" {
+		in.would("remove %s", filepath.Join(config.BinDir(), name))
+	}
+	in.would("remove %s", config.ServiceBinary(name))
 }
 
 func Check(name string) (string, error) {
@@ -311,13 +434,22 @@ func formatBytes(b int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
 }
 
-func createSymlink(name string, progress func(string)) {
+func (in *installer) createSymlink(name string) {
 	if runtime.GOOS == "windows" {
 		return
 	}
 
+	progress := in.progress
 	binary := config.ServiceBinary(name)
-	linkPath := filepath.Join("/usr/local/bin", name)
+	if in.dryRun {
+		in.would("link %s to %s", filepath.Join(config.BinDir(), name), binary)
+		return
+	}
+	if err := os.MkdirAll(config.BinDir(), 0755); err != nil {
+		progress(fmt.Sprintf("Warning: failed to create %s: %v", config.BinDir(), err))
+		return
+	}
+	linkPath := filepath.Join(config.BinDir(), name)
 
 	os.Remove(linkPath)
 	if err := os.Symlink(binary, linkPath); err != nil {
@@ -325,13 +457,16 @@ func createSymlink(name string, progress func(string)) {
 	}
 }
 
-func installSystemDeps(deps []registry.SystemDep, progress func(string)) error {
+func (in *installer) installSystemDeps(deps []registry.SystemDep) error {
+	progress := in.progress
 	for _, dep := range deps {
 		if isCommandAvailable(dep.Name) {
 			continue
 		}
 
-		progress(fmt.Sprintf("Installing system dependency: %s", dep.Name))
+		if !in.dryRun {
+			progress(fmt.Sprintf("Installing system dependency: %s", dep.Name))
+		}
 
 		var cmd *exec.Cmd
 		switch runtime.GOOS {
@@ -347,15 +482,19 @@ func installSystemDeps(deps []registry.SystemDep, progress func(string)) error {
 			if dep.UnixScript != "" {
 				cmd = exec.Command("bash", "-c", dep.UnixScript)
 			} else if dep.Apt != "" {
-				cmd = exec.Command("sudo", "apt-get", "install", "-y", dep.Apt)
+				cmd = elevated("apt-get", "install", "-y", dep.Apt)
 			} else {
 				return fmt.Errorf("no install method for %s on linux", dep.Name)
 			}
 		case "windows":
 			if dep.Winget != "" {
 				if !isCommandAvailable("winget") {
-					progress("Installing winget...")
-					installWinget()
+					if in.dryRun {
+						in.would("install winget")
+					} else {
+						progress("Installing winget...")
+						installWinget()
+					}
 				}
 				cmd = exec.Command("winget", "install",
 					"--silent",
@@ -365,10 +504,6 @@ func installSystemDeps(deps []registry.SystemDep, progress func(string)) error {
 					"--no-upgrade",
 					"--force",
 					dep.Winget)
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				cmd.Run() // ignore errors - either installed or not, continue
-				continue
 			} else if dep.WinScript != "" {
 				cmd = exec.Command("powershell", "-NoProfile", "-Command", dep.WinScript)
 			} else if dep.UnixScript != "" && isCommandAvailable("bash") {
@@ -380,8 +515,17 @@ func installSystemDeps(deps []registry.SystemDep, progress func(string)) error {
 			return fmt.Errorf("unsupported OS: %s", runtime.GOOS)
 		}
 
+		if in.dryRun {
+			in.would("install system dependency %s: %s", dep.Name, strings.Join(cmd.Args, " "))
+			continue
+		}
+
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
+		if runtime.GOOS == "windows" && dep.Winget != "" {
+			cmd.Run() // ignore errors - either installed or not, continue
+			continue
+		}
 		if err := cmd.Run(); err != nil {
 			return fmt.Errorf("failed to install %s: %w", dep.Name, err)
 		}
@@ -410,17 +554,49 @@ func isCommandAvailable(name string) bool {
 	return err == nil
 }
 
-func installClaudeMd(svc *registry.Service, progress func(string)) {
+// elevated runs a command as root for a single privileged step. The
+// orchestrator itself may run unprivileged (user mode); without a terminal
+// to prompt on, pkexec asks for the password graphically.
+func elevated(name string, args ...string) *exec.Cmd {
+	if os.Getuid() == 0 {
+		return exec.Command(name, args...)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) && isCommandAvailable("pkexec") {
+		return exec.Command("pkexec", append([]string{name}, args...)...)
+	}
+	cmd := exec.Command("sudo", append([]string{name}, args...)...)
+	cmd.Stdin = os.Stdin
+	return cmd
+}
+
+func (in *installer) installClaudeMd(svc *registry.Service) {
 	if svc.ClaudeRoot {
-		installClaudeRoot(svc, progress)
+		in.installClaudeRoot(svc)
 	} else {
-		installClaudeService(svc, progress)
+		in.installClaudeService(svc)
+	}
+}
+
+// download fetches url to dest, or reports it in a dry run.
+func (in *installer) download(url, dest string) error {
+	if in.dryRun {
+		in.would("download %s to %s", url, dest)
+		return nil
 	}
+	return downloadFile(url, dest, in.progress)
 }
 
-func installClaudeRoot(svc *registry.Service, progress func(string)) {
+// mkdir creates dir unless this is a dry run.
+func (in *installer) mkdir(dir string) error {
+	if in.dryRun {
+		return nil
+	}
+	return os.MkdirAll(dir, 0755)
+}
+
+func (in *installer) installClaudeRoot(svc *registry.Service) {
 	claudeDir := config.AgentClaudeDir()
-	if err := os.MkdirAll(claudeDir, 0755); err != nil {
+	if err := in.mkdir(claudeDir); err != nil {
 		return
 	}
 
@@ -432,16 +608,16 @@ func installClaudeRoot(svc *registry.Service, progress func(string)) {
 		if _, err := os.Stat(destPath); err == nil {
 			continue
 		}
-		downloadFile(baseURL+"/"+file, destPath, progress)
+		in.download(baseURL+"/"+file, destPath)
 	}
 
 	// Install orchestrator docs (always bundled with agent)
-	installOrchestratorDocs(progress)
+	in.installOrchestratorDocs()
 }
 
-func installOrchestratorDocs(progress func(string)) {
+func (in *installer) installOrchestratorDocs() {
 	claudeDir := config.AgentClaudeServiceDir("pink-orchestrator")
-	if err := os.MkdirAll(claudeDir, 0755); err != nil {
+	if err := in.mkdir(claudeDir); err != nil {
 		return
 	}
 
@@ -451,22 +627,26 @@ func installOrchestratorDocs(progress func(string)) {
 	}
 
 	url := "https://raw.githubusercontent.com/pink-tools/pink-orchestrator/main/.claude/CLAUDE.md"
-	downloadFile(url, dest, progress)
+	in.download(url, dest)
 }
 
-func installClaudeService(svc *registry.Service, progress func(string)) {
+func (in *installer) installClaudeService(svc *registry.Service) {
 	claudeDir := config.AgentClaudeServiceDir(svc.Name)
-	if err := os.MkdirAll(claudeDir, 0755); err != nil {
+	if err := in.mkdir(claudeDir); err != nil {
 		return
 	}
 
 	claudeMdURL := fmt.Sprintf("https://raw.githubusercontent.com/%s/main/.claude/CLAUDE.md", svc.Repo)
 	claudeMdPath := config.AgentClaudeServiceMd(svc.Name)
 
-	if err := downloadFile(claudeMdURL, claudeMdPath, progress); err != nil {
+	if err := in.download(claudeMdURL, claudeMdPath); err != nil {
 		return
 	}
 
+	if in.dryRun {
+		in.would("reference %s/CLAUDE.md in %s", svc.Name, config.AgentClaudeProjectsMd())
+		return
+	}
 	updateProjectsMd(svc.Name)
 }
 
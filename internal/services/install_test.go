@@ -0,0 +1,112 @@
+package services
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+)
+
+func TestDryRun(t *testing.T) {
+	binary := config.ServiceBinary("svc-daemon")
+	release := "https://github.com/example/svc-daemon/releases/download/v1.2.0/"
+	tests := []struct {
+		name       string
+		installed  bool
+		running    bool
+		run        func(progress func(string)) error
+		wantSteps  []string // each reported by some step, in this order
+		wantAbsent []string // reported by no step
+	}{
+		{
+			"install", false, false,
+			func(progress func(string)) error { return InstallDryRun("svc-daemon", "v1.2.0", progress) },
+			[]string{"Would download " + release, "Would check " + binary + " --version"},
+			[]string{"Would stop", "Would move"},
+		},
+		{
+			"replace running", true, true,
+			func(progress func(string)) error {
+				return (&installer{progress: progress, dryRun: true}).replace("svc-daemon", "v1.2.0")
+			},
+			[]string{"Would stop svc-daemon", "Would move " + binary + " to " + binary + ".old",
+				"Would download " + release, "Would start svc-daemon"},
+			nil,
+		},
+		{
+			"replace stopped", true, false,
+			func(progress func(string)) error {
+				return (&installer{progress: progress, dryRun: true}).replace("svc-daemon", "v1.2.0")
+			},
+			[]string{"Would move " + binary + " to " + binary + ".old", "Would download " + release},
+			[]string{"Would stop", "Would start"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeService(t, "svc-daemon", &ServiceRecord{Desired: DesiredStopped, Version: "v1.0.0"}, tt.installed, tt.running)
+			before := snapshotFiles(t)
+			rec := *Record("svc-daemon")
+			mu.RLock()
+			processes := len(runningProcesses)
+			mu.RUnlock()
+
+			var steps []string
+			if err := tt.run(func(msg string) { steps = append(steps, msg) }); err != nil {
+				t.Fatalf("dry run error = %v", err)
+			}
+
+			next := 0
+			for _, step := range steps {
+				if next < len(tt.wantSteps) && strings.HasPrefix(step, tt.wantSteps[next]) {
+					next++
+				}
+				for _, absent := range tt.wantAbsent {
+					if strings.HasPrefix(step, absent) {
+						t.Errorf("reported %q", step)
+					}
+				}
+			}
+			if next < len(tt.wantSteps) {
+				t.Errorf("steps = %q, missing %q", steps, tt.wantSteps[next])
+			}
+
+			if after := snapshotFiles(t); !reflect.DeepEqual(after, before) {
+				t.Errorf("files changed:\nbefore %v\nafter  %v", before, after)
+			}
+			if got := Record("svc-daemon"); got == nil || !reflect.DeepEqual(*got, rec) {
+				t.Errorf("record = %+v, want %+v", got, rec)
+			}
+			mu.RLock()
+			defer mu.RUnlock()
+			if len(runningProcesses) != processes {
+				t.Errorf("%d running processes, want %d", len(runningProcesses), processes)
+			}
+		})
+	}
+}
+
+// snapshotFiles returns the size of every file under the test's home.
+func snapshotFiles(t *testing.T) map[string]int64 {
+	t.Helper()
+	files := make(map[string]int64)
+	err := filepath.WalkDir(os.Getenv("HOME"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[path] = info.Size()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
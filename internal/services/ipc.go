@@ -10,21 +10,14 @@ import (
 	"strings"
 	"time"
 
-	"github.com/pink-tools/pink-core"
+	"github.com/pink-tools/pink-orchestrator/internal/config"
 )
 
 // sendIPCStop sends STOP command via IPC to gracefully shutdown a service
 // Returns true if the service acknowledged the stop command
 func sendIPCStop(name string) bool {
-	portFile := filepath.Join(core.ServiceDir(name), name+".port")
-
-	data, err := os.ReadFile(portFile)
-	if err != nil {
-		return false
-	}
-
-	port, err := strconv.Atoi(strings.TrimSpace(string(data)))
-	if err != nil {
+	port, ok := readPort(name)
+	if !ok {
 		return false
 	}
 
@@ -48,15 +41,8 @@ func sendIPCStop(name string) bool {
 
 // isIPCRunning checks if service is running via IPC ping
 func isIPCRunning(name string) bool {
-	portFile := filepath.Join(core.ServiceDir(name), name+".port")
-
-	data, err := os.ReadFile(portFile)
-	if err != nil {
-		return false
-	}
-
-	port, err := strconv.Atoi(strings.TrimSpace(string(data)))
-	if err != nil {
+	port, ok := readPort(name)
+	if !ok {
 		return false
 	}
 
@@ -73,3 +59,16 @@ func isIPCRunning(name string) bool {
 	response, _ := reader.ReadString('\n')
 	return strings.TrimSpace(response) == "PONG"
 }
+
+// readPort returns the IPC port a service published.
+func readPort(name string) (int, bool) {
+	data, err := os.ReadFile(filepath.Join(config.ServiceDir(name), name+".port"))
+	if err != nil {
+		return 0, false
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+	return port, true
+}
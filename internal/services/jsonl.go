@@ -0,0 +1,58 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// appendJSONLine appends v to a JSON Lines file, trimming it to the newest
+// keep lines once it has grown to twice that. Callers serialise access.
+func appendJSONLine(path string, v any, keep int) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	f.Write(append(data, '\n'))
+	f.Close()
+
+	lines, err := readJSONLines(path)
+	if err != nil || len(lines) < 2*keep {
+		return
+	}
+	lines = lines[len(lines)-keep:]
+	tmpFile := path + ".tmp"
+	if err := os.WriteFile(tmpFile, append(bytes.Join(lines, []byte("\n")), '\n'), 0644); err != nil {
+		return
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		os.Remove(tmpFile)
+	}
+}
+
+func readJSONLines(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,311 @@
+//go:build linux
+
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pink-tools/pink-otel"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	cgroupRoot   = "/sys/fs/cgroup"
+	cgroupPeriod = 100000 // cpu.max period in microseconds
+)
+
+// limiter applies a service's resource limits. Each service gets its own
+// cgroup v2 subtree; where cgroups aren't writable, rlimits stand in.
+type limiter struct {
+	name   string
+	limits *registry.Limits
+	memory int64
+	cgroup string   // service cgroup directory, empty when falling back
+	fd     *os.File // cgroup directory handed to clone3
+}
+
+func newLimiter(svc *registry.Service) (*limiter, error) {
+	if svc.Limits == nil {
+		return nil, nil
+	}
+	if err := svc.Limits.Validate(); err != nil {
+		return nil, fmt.Errorf("limits: %w", err)
+	}
+	memory, _ := svc.Limits.MemoryBytes()
+	return &limiter{name: svc.Name, limits: svc.Limits, memory: memory}, nil
+}
+
+// start starts cmd under the limits. The process stops at its first
+// instruction while the per-process limits are set, so the service never
+// runs without them. Spawning into a cgroup needs clone3 (Linux 5.7) and
+// stopping needs ptrace; where either fails, the start is retried without
+// them, under rlimits set right after the process starts. A retry runs a
+// copy of cmd, which is returned.
+func (l *limiter) start(cmd *exec.Cmd) (*exec.Cmd, error) {
+	if l == nil {
+		return cmd, cmd.Start()
+	}
+	if l.needsCgroup() {
+		l.apply(cmd)
+	}
+	stop := l.needsSet()
+	err := l.spawn(cmd, stop)
+	if err != nil && (l.fd != nil || stop) {
+		otel.Warn(context.Background(), l.name, otel.Attr{"status", "limited start failed, retrying with rlimits"}, otel.Attr{"error", err.Error()})
+		l.release()
+		l.cgroup = ""
+		cmd = retryCmd(cmd)
+		err = l.spawn(cmd, false)
+	}
+	if err != nil {
+		l.release()
+		return cmd, err
+	}
+	if l.fd != nil {
+		l.fd.Close()
+		l.fd = nil
+	}
+	return cmd, nil
+}
+
+// apply places cmd in the service cgroup at spawn time.
+func (l *limiter) apply(cmd *exec.Cmd) {
+	dir, err := l.setupCgroup()
+	if err != nil {
+		otel.Warn(context.Background(), l.name, otel.Attr{"status", "cgroup limits unavailable, using rlimits"}, otel.Attr{"error", err.Error()})
+		return
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		os.Remove(dir)
+		otel.Warn(context.Background(), l.name, otel.Attr{"status", "cgroup limits unavailable, using rlimits"}, otel.Attr{"error", err.Error()})
+		return
+	}
+	l.cgroup, l.fd = dir, fd
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(fd.Fd())
+}
+
+// spawn starts cmd and sets its per-process limits, with the process
+// stopped at exec when stop is set.
+func (l *limiter) spawn(cmd *exec.Cmd, stop bool) error {
+	if !stop {
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		l.set(cmd.Process.Pid)
+		return nil
+	}
+
+	// The tracer is the thread that forked the process
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Ptrace = true
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	pid := cmd.Process.Pid
+	var status unix.WaitStatus
+	_, err := unix.Wait4(pid, &status, 0, nil)
+	for err == unix.EINTR {
+		_, err = unix.Wait4(pid, &status, 0, nil)
+	}
+	if err != nil || !status.Stopped() {
+		// Killed before exec; Wait reports it
+		return nil
+	}
+	l.set(pid)
+	if err := unix.PtraceDetach(pid); err != nil {
+		otel.Warn(context.Background(), l.name, otel.Attr{"status", "failed to resume service"}, otel.Attr{"error", err.Error()})
+	}
+	return nil
+}
+
+// set applies the per-process limits cgroups don't cover, plus the rlimit
+// fallbacks when the service isn't in a cgroup.
+func (l *limiter) set(pid int) {
+	if l.limits.NoFile > 0 {
+		l.prlimit(pid, unix.RLIMIT_NOFILE, l.limits.NoFile, "nofile")
+	}
+	if l.limits.Nice != 0 {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, pid, l.limits.Nice); err != nil {
+			otel.Warn(context.Background(), l.name, otel.Attr{"status", "failed to set nice"}, otel.Attr{"error", err.Error()})
+		}
+	}
+
+	if l.cgroup != "" {
+		return
+	}
+	if l.memory > 0 {
+		l.prlimit(pid, unix.RLIMIT_AS, uint64(l.memory), "memory")
+	}
+	if l.limits.PIDs > 0 {
+		// Counts every process of the service user, not just this service
+		l.prlimit(pid, unix.RLIMIT_NPROC, uint64(l.limits.PIDs), "pids")
+	}
+	if l.limits.CPU > 0 {
+		otel.Warn(context.Background(), l.name, otel.Attr{"status", "cpu limit needs cgroups, not enforced"})
+	}
+}
+
+// retryCmd is a fresh copy of cmd, which can't be started twice, without
+// the cgroup and tracing.
+func retryCmd(cmd *exec.Cmd) *exec.Cmd {
+	retry := &exec.Cmd{
+		Path:       cmd.Path,
+		Args:       cmd.Args,
+		Env:        cmd.Env,
+		Dir:        cmd.Dir,
+		Stdin:      cmd.Stdin,
+		Stdout:     cmd.Stdout,
+		Stderr:     cmd.Stderr,
+		ExtraFiles: cmd.ExtraFiles,
+	}
+	if cmd.SysProcAttr != nil {
+		attr := *cmd.SysProcAttr
+		attr.UseCgroupFD, attr.CgroupFD, attr.Ptrace = false, 0, false
+		retry.SysProcAttr = &attr
+	}
+	return retry
+}
+
+// release removes the service cgroup once the process has exited.
+func (l *limiter) release() {
+	if l == nil {
+		return
+	}
+	if l.fd != nil {
+		l.fd.Close()
+		l.fd = nil
+	}
+	if l.cgroup != "" {
+		os.Remove(l.cgroup)
+	}
+}
+
+func (l *limiter) needsCgroup() bool {
+	return l.memory > 0 || l.limits.CPU > 0 || l.limits.PIDs > 0
+}
+
+// needsSet reports whether set has limits to apply to the process.
+func (l *limiter) needsSet() bool {
+	return l.limits.NoFile > 0 || l.limits.Nice != 0 ||
+		(l.cgroup == "" && (l.memory > 0 || l.limits.PIDs > 0))
+}
+
+func (l *limiter) prlimit(pid int, resource int, value uint64, label string) {
+	lim := &unix.Rlimit{Cur: value, Max: value}
+	if err := unix.Prlimit(pid, resource, lim, nil); err != nil {
+		otel.Warn(context.Background(), l.name, otel.Attr{"status", "failed to set " + label + " limit"}, otel.Attr{"error", err.Error()})
+	}
+}
+
+// setupCgroup creates the service cgroup and writes its limits.
+func (l *limiter) setupCgroup() (string, error) {
+	parent, err := cgroupParent()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(parent, l.name)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+
+	memory, cpu, pids := "max", "max", "max"
+	if l.memory > 0 {
+		memory = strconv.FormatInt(l.memory, 10)
+	}
+	if l.limits.CPU > 0 {
+		cpu = strconv.Itoa(int(l.limits.CPU * cgroupPeriod))
+	}
+	if l.limits.PIDs > 0 {
+		pids = strconv.Itoa(l.limits.PIDs)
+	}
+
+	files := []struct{ file, value string }{
+		{"memory.max", memory},
+		{"cpu.max", fmt.Sprintf("%s %d", cpu, cgroupPeriod)},
+		{"pids.max", pids},
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.file), []byte(f.value), 0644); err != nil {
+			os.Remove(dir)
+			return "", fmt.Errorf("write %s: %w", f.file, err)
+		}
+	}
+	return dir, nil
+}
+
+// cgroupParent returns a writable cgroup that holds one child per service,
+// with the memory, cpu and pids controllers delegated to the children. As
+// root it sits at the top of the hierarchy; otherwise next to the
+// orchestrator's own cgroup, which works inside a delegated user session.
+func cgroupParent() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("cgroup v2 is not mounted at %s", cgroupRoot)
+	}
+
+	candidates := []string{filepath.Join(cgroupRoot, "pink-orchestrator")}
+	if own := ownCgroup(); own != "" && own != "/" {
+		candidates = append(candidates, filepath.Join(cgroupRoot, filepath.Dir(own), "pink-orchestrator"))
+	}
+
+	var lastErr error
+	for _, dir := range candidates {
+		if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+			lastErr = err
+			continue
+		}
+		enableControllers(filepath.Dir(dir))
+		if err := enableControllers(dir); err != nil {
+			lastErr = err
+			continue
+		}
+		return dir, nil
+	}
+	return "", lastErr
+}
+
+// enableControllers delegates the limit controllers to dir's children.
+func enableControllers(dir string) error {
+	control := filepath.Join(dir, "cgroup.subtree_control")
+	for _, c := range []string{"memory", "cpu", "pids"} {
+		if err := os.WriteFile(control, []byte("+"+c), 0644); err != nil {
+			return fmt.Errorf("enable %s controller in %s: %w", c, dir, err)
+		}
+	}
+	return nil
+}
+
+// ownCgroup returns the orchestrator's cgroup v2 path, e.g. "/user.slice/...".
+func ownCgroup() string {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/pink-tools/pink-otel"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+)
+
+// limiter is a no-op outside Linux: limits are logged as not enforced.
+type limiter struct{}
+
+func newLimiter(svc *registry.Service) (*limiter, error) {
+	if svc.Limits == nil {
+		return nil, nil
+	}
+	if err := svc.Limits.Validate(); err != nil {
+		return nil, fmt.Errorf("limits: %w", err)
+	}
+	otel.Warn(context.Background(), svc.Name, otel.Attr{"status", "resource limits are only enforced on Linux"})
+	return nil, nil
+}
+
+func (l *limiter) start(cmd *exec.Cmd) (*exec.Cmd, error) {
+	return cmd, cmd.Start()
+}
+
+func (l *limiter) release() {}
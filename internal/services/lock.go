@@ -0,0 +1,129 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+)
+
+// LockOwner is the instance holding the orchestrator lock, as recorded in
+// the lock file.
+type LockOwner struct {
+	PID     int       `json:"pid"`
+	Version string    `json:"version,omitempty"`
+	Port    int       `json:"port,omitempty"` // API port
+	Binary  string    `json:"binary,omitempty"`
+	Started time.Time `json:"started,omitzero"`
+}
+
+// LockError is returned by AcquireLock while another process holds the lock.
+type LockError struct {
+	Owner   *LockOwner // nil when the lock file couldn't be read
+	Running bool       // Owner is a live pink-orchestrator process
+}
+
+func (e *LockError) Error() string {
+	switch {
+	case e.Owner == nil:
+		return "another instance is already running"
+	case !e.Running:
+		return fmt.Sprintf("the lock is held, but pid %d recorded in %s is not a running pink-orchestrator", e.Owner.PID, lockPath())
+	case e.Owner.Version == "":
+		// Recorded by an older version
+		return fmt.Sprintf("another instance is already running (pid %d)", e.Owner.PID)
+	}
+	return fmt.Sprintf("another instance is already running (pid %d, v%s, API port %d)", e.Owner.PID, e.Owner.Version, e.Owner.Port)
+}
+
+var lockFile *os.File
+
+func lockPath() string {
+	return filepath.Join(config.OrchestratorDir(), "orchestrator.lock")
+}
+
+// AcquireLock makes this process the only running orchestrator and records
+// it in the lock file.
+func AcquireLock() error {
+	f, err := os.OpenFile(lockPath(), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := lockFileHandle(f); err != nil {
+		f.Close()
+		lockErr := &LockError{}
+		if owner, err := readLockOwner(); err == nil {
+			lockErr.Owner = owner
+			lockErr.Running = owner.running()
+		}
+		return lockErr
+	}
+
+	owner := LockOwner{PID: os.Getpid(), Version: orchestratorVersion, Port: config.Port(), Started: time.Now()}
+	if exe, err := os.Executable(); err == nil {
+		owner.Binary = exe
+	}
+	if _, start, err := processIdentity(owner.PID); err == nil {
+		owner.Started = start
+	}
+	data, _ := json.MarshalIndent(owner, "", "  ")
+	f.Truncate(0)
+	f.WriteAt(data, 0)
+
+	lockFile = f
+	return nil
+}
+
+// WaitForLock retries AcquireLock until the owner has let go or timeout
+// has passed.
+func WaitForLock(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := AcquireLock()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func ReleaseLock() {
+	if lockFile != nil {
+		unlockFileHandle(lockFile)
+		lockFile.Close()
+		lockFile = nil
+	}
+}
+
+// readLockOwner reads the lock file. Older versions wrote only the PID.
+func readLockOwner() (*LockOwner, error) {
+	data, err := os.ReadFile(lockPath())
+	if err != nil {
+		return nil, err
+	}
+	var owner LockOwner
+	if err := json.Unmarshal(data, &owner); err != nil {
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("unreadable lock file")
+		}
+		owner = LockOwner{PID: pid}
+	}
+	return &owner, nil
+}
+
+// running reports whether the owner is a live pink-orchestrator process,
+// not an unrelated program that reused its PID.
+func (o *LockOwner) running() bool {
+	if o.Binary != "" && !o.Started.IsZero() {
+		return (&pidRecord{PID: o.PID, Binary: o.Binary, Started: o.Started}).alive()
+	}
+	exe, _, err := processIdentity(o.PID)
+	return err == nil && strings.HasPrefix(filepath.Base(exe), "pink-orchestrator")
+}
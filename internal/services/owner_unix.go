@@ -0,0 +1,33 @@
+//go:build !windows
+
+package services
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// chownLike gives path the owner of ref. Without ref, files created while
+// running under sudo are handed to the invoking user, who runs the services.
+func chownLike(path string, ref os.FileInfo) {
+	if ref != nil {
+		if st, ok := ref.Sys().(*syscall.Stat_t); ok {
+			os.Chown(path, int(st.Uid), int(st.Gid))
+		}
+		return
+	}
+	if os.Getuid() != 0 {
+		return
+	}
+	uid, err1 := strconv.Atoi(os.Getenv("SUDO_UID"))
+	gid, err2 := strconv.Atoi(os.Getenv("SUDO_GID"))
+	if err1 == nil && err2 == nil {
+		os.Chown(path, uid, gid)
+	}
+}
+
+// ChownToInvoker gives a file created under sudo to the invoking user.
+func ChownToInvoker(path string) {
+	chownLike(path, nil)
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package services
+
+import "os"
+
+// chownLike is a no-op on Windows, where files inherit directory ACLs.
+func chownLike(path string, ref os.FileInfo) {}
+
+// ChownToInvoker is a no-op on Windows.
+func ChownToInvoker(path string) {}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pink-tools/pink-otel"
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+)
+
+const (
+	// startTolerance absorbs the coarse start times some platforms report.
+	startTolerance = 2 * time.Second
+	orphanStopWait = 10 * time.Second
+)
+
+// pidRecord identifies a service process across orchestrator restarts.
+// The PID alone isn't enough: it may have been reused by another program.
+type pidRecord struct {
+	PID     int       `json:"pid"`
+	Binary  string    `json:"binary"`
+	Started time.Time `json:"started"`
+	// Detached processes write to log files; the others to pipes that died
+	// with the orchestrator that started them
+	Detached bool `json:"detached,omitempty"`
+}
+
+func writePidFile(name string, pid int, detached bool) {
+	rec := pidRecord{PID: pid, Binary: config.ServiceBinary(name), Started: time.Now(), Detached: detached}
+	if _, start, err := processIdentity(pid); err == nil {
+		rec.Started = start
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(config.ServicePidFile(name), data, 0644); err != nil {
+		otel.Warn(context.Background(), name, otel.Attr{"status", "failed to write pid file"}, otel.Attr{"error", err.Error()})
+	}
+}
+
+func readPidFile(name string) (*pidRecord, error) {
+	data, err := os.ReadFile(config.ServicePidFile(name))
+	if err != nil {
+		return nil, err
+	}
+	var rec pidRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func removePidFile(name string) {
+	os.Remove(config.ServicePidFile(name))
+}
+
+// alive reports whether the recorded process still runs: same PID, same
+// executable, same start time.
+func (r *pidRecord) alive() bool {
+	exe, start, err := processIdentity(r.PID)
+	if err != nil {
+		return false
+	}
+	if d := start.Sub(r.Started); d > startTolerance || d < -startTolerance {
+		return false
+	}
+	// An update moves the running binary aside before replacing it
+	exe = strings.TrimSuffix(exe, ".old")
+	if !filepath.IsAbs(exe) {
+		// Some platforms only report the command name
+		return exe == filepath.Base(r.Binary)
+	}
+	return sameFile(exe, r.Binary)
+}
+
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ra, err1 := filepath.EvalSymlinks(a)
+	rb, err2 := filepath.EvalSymlinks(b)
+	return err1 == nil && err2 == nil && ra == rb
+}
+
+// AdoptOrphans handles service processes that outlived a previous
+// orchestrator session. Detached ones the saved state expects running are
+// adopted; the rest are stopped gracefully, and RestoreState starts those
+// expected running again. A process that wasn't detached had its output
+// piped to the previous orchestrator: its next write would fail or kill it.
+// Stale PID files are removed.
+func AdoptOrphans() {
+	stateMu.Lock()
+	loadState()
+	wanted := make(map[string]bool)
+	for name, rec := range state.Services {
+		wanted[name] = rec.Desired == DesiredStarted
+	}
+	stateMu.Unlock()
+
+	svcs, _ := registry.ListServices()
+	for _, svc := range svcs {
+		rec, err := readPidFile(svc.Name)
+		if err != nil {
+			continue
+		}
+		if !rec.alive() {
+			removePidFile(svc.Name)
+			continue
+		}
+		if wanted[svc.Name] && rec.Detached {
+			adopt(svc.Name, rec)
+		} else {
+			stopOrphan(svc.Name, rec)
+		}
+	}
+}
+
+// adopt tracks a process started by a previous session. It can't be waited
+// on, so its liveness is polled; output is followed through its log files
+// when it was started detached.
+func adopt(name string, rec *pidRecord) {
+	process, err := os.FindProcess(rec.PID)
+	if err != nil {
+		return
+	}
+	otel.Info(context.Background(), name, otel.Attr{"status", "adopted"}, otel.Attr{"pid", rec.PID})
+
+	info := &processInfo{
+		process:  process,
+		done:     make(chan struct{}),
+		adopted:  true,
+		detached: true,
+	}
+	mu.Lock()
+	runningProcesses[name] = info
+	mu.Unlock()
+	tailServiceLogs(name, info.done)
+	adoptProbes(name, info.done)
+
+	go func() {
+		for rec.alive() {
+			time.Sleep(time.Second)
+		}
+		mu.Lock()
+		if runningProcesses[name] == info {
+			delete(runningProcesses, name)
+		}
+		stopping := info.stopping
+		mu.Unlock()
+		removePidFile(name)
+		recordExit(name, RunRecord{Started: rec.Started, PID: rec.PID}, nil, nil, stopping)
+		close(info.done)
+		otel.Info(context.Background(), name, otel.Attr{"status", "exited"})
+		notifyStatusUpdate()
+	}()
+}
+
+// adoptProbes resumes probing an adopted service, rebuilding the
+// environment it was started with as far as it can be known.
+func adoptProbes(name string, done <-chan struct{}) {
+	svc, err := registry.GetService(name)
+	if err != nil || svc.Probes == nil {
+		return
+	}
+	runAs, err := lookupServiceUser(svc)
+	if err != nil {
+		return
+	}
+	env, sources, _ := buildServiceEnv(name, nil)
+	env = runAs.environ(env, sources)
+	if resolved, err := resolveSecrets(env); err == nil {
+		env = resolved
+	}
+	probes, err := newProber(svc, env, runAs)
+	if err != nil {
+		otel.Warn(context.Background(), name, otel.Attr{"status", "probes disabled"}, otel.Attr{"error", err.Error()})
+		return
+	}
+	probes.start(done, nil)
+}
+
+// stopOrphan stops a leftover process: IPC first, then a termination
+// signal, then a kill, each given time to take effect.
+func stopOrphan(name string, rec *pidRecord) {
+	otel.Info(context.Background(), name, otel.Attr{"status", "stopping orphan"}, otel.Attr{"pid", rec.PID})
+	defer removePidFile(name)
+
+	if sendIPCStop(name) && waitExit(rec, orphanStopWait) {
+		return
+	}
+	process, err := os.FindProcess(rec.PID)
+	if err != nil {
+		return
+	}
+	if terminate(process) == nil && waitExit(rec, orphanStopWait) {
+		return
+	}
+	otel.Warn(context.Background(), name, otel.Attr{"status", "killing orphan"}, otel.Attr{"pid", rec.PID})
+	process.Kill()
+	waitExit(rec, orphanStopWait)
+}
+
+func waitExit(rec *pidRecord, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !rec.alive() {
+			return true
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return !rec.alive()
+}
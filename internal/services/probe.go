@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pink-tools/pink-otel"
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+)
+
+const (
+	ProbeReadiness = "readiness"
+	ProbeLiveness  = "liveness"
+)
+
+// ProbeResult is the state of one probe of a running service.
+type ProbeResult struct {
+	Passing   bool      `json:"passing"`
+	Failures  int       `json:"failures,omitempty"` // consecutive
+	LastError string    `json:"last_error,omitempty"`
+	LastCheck time.Time `json:"last_check,omitempty"`
+}
+
+// probeResults maps service → probe name → result; guarded by mu.
+var probeResults = make(map[string]map[string]*ProbeResult)
+
+// prober runs a service's probes in the environment the service got.
+type prober struct {
+	name   string
+	probes *registry.Probes
+	env    []string
+	runAs  *serviceUser
+}
+
+// newProber validates svc's probes; it returns nil when there are none.
+func newProber(svc *registry.Service, env []string, runAs *serviceUser) (*prober, error) {
+	if svc.Probes == nil || (svc.Probes.Readiness == nil && svc.Probes.Liveness == nil) {
+		return nil, nil
+	}
+	for kind, p := range map[string]*registry.Probe{ProbeReadiness: svc.Probes.Readiness, ProbeLiveness: svc.Probes.Liveness} {
+		if p == nil {
+			continue
+		}
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("%s probe: %w", kind, err)
+		}
+	}
+	return &prober{name: svc.Name, probes: svc.Probes, env: env, runAs: runAs}, nil
+}
+
+// readiness returns the readiness probe, or nil.
+func (pr *prober) readiness() *registry.Probe {
+	if pr == nil {
+		return nil
+	}
+	return pr.probes.Readiness
+}
+
+// start runs the probes until done is closed. readyErr is the outcome of
+// the start-up readiness wait: the readiness probe begins as failing with
+// it, or as passing when it's nil. The liveness probe begins as passing.
+func (pr *prober) start(done <-chan struct{}, readyErr error) {
+	if pr == nil {
+		return
+	}
+	if p := pr.probes.Readiness; p != nil {
+		result := &ProbeResult{Passing: true}
+		if readyErr != nil {
+			result = &ProbeResult{LastError: readyErr.Error(), LastCheck: time.Now()}
+		}
+		go pr.run(ProbeReadiness, p, result, done)
+	}
+	if p := pr.probes.Liveness; p != nil {
+		go pr.run(ProbeLiveness, p, &ProbeResult{Passing: true}, done)
+	}
+}
+
+func (pr *prober) run(kind string, p *registry.Probe, result *ProbeResult, done <-chan struct{}) {
+	interval, _ := p.IntervalDuration()
+
+	mu.Lock()
+	if probeResults[pr.name] == nil {
+		probeResults[pr.name] = make(map[string]*ProbeResult)
+	}
+	probeResults[pr.name][kind] = result
+	mu.Unlock()
+
+	defer func() {
+		mu.Lock()
+		if probeResults[pr.name][kind] == result {
+			delete(probeResults[pr.name], kind)
+		}
+		mu.Unlock()
+	}()
+
+	successes := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+
+		err := pr.check(p)
+
+		mu.Lock()
+		wasPassing := result.Passing
+		result.LastCheck = time.Now()
+		if err == nil {
+			successes++
+			result.Failures = 0
+			result.LastError = ""
+			if successes >= p.Successes() {
+				result.Passing = true
+			}
+		} else {
+			successes = 0
+			result.Failures++
+			result.LastError = err.Error()
+			if result.Failures >= p.Failures() {
+				result.Passing = false
+			}
+		}
+		passing := result.Passing
+		mu.Unlock()
+
+		if passing == wasPassing {
+			continue
+		}
+		if passing {
+			otel.Info(context.Background(), pr.name, otel.Attr{"status", kind + " probe passing"})
+		} else {
+			otel.Warn(context.Background(), pr.name, otel.Attr{"status", kind + " probe failing"}, otel.Attr{"error", err.Error()})
+		}
+		notifyStatusUpdate()
+
+		if kind == ProbeLiveness && !passing {
+			go restartUnhealthy(pr.name, err)
+			return
+		}
+	}
+}
+
+// check runs a probe once.
+func (pr *prober) check(p *registry.Probe) error {
+	timeout, _ := p.TimeoutDuration()
+	expand := func(s string) string { return expandVars(s, pr.name, pr.env) }
+
+	switch p.Kind {
+	case registry.ProbeIPC:
+		if !isIPCRunning(pr.name) {
+			return fmt.Errorf("no PONG on the IPC port")
+		}
+	case registry.ProbeTCP:
+		conn, err := net.DialTimeout("tcp", expand(p.Address), timeout)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	case registry.ProbeHTTP:
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Get(expand(p.URL))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if p.Status != 0 && resp.StatusCode != p.Status {
+			return fmt.Errorf("HTTP %d, want %d", resp.StatusCode, p.Status)
+		}
+		if p.Status == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+			return fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+	case registry.ProbeExec:
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		args := make([]string, len(p.Command))
+		for i, arg := range p.Command {
+			args[i] = expand(arg)
+		}
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Dir = config.ServiceDir(pr.name)
+		cmd.Env = pr.env
+		pr.runAs.apply(cmd)
+		out, err := cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		if err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return fmt.Errorf("%w: %s", err, truncateLine(msg, 200))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// restartUnhealthy restarts a service whose liveness probe failed. A hung
+// service may not answer the IPC stop, so it is terminated instead.
+func restartUnhealthy(name string, cause error) {
+	otel.Warn(context.Background(), name, otel.Attr{"status", "restarting after failed liveness probe"})
+
+	mu.RLock()
+	info := runningProcesses[name]
+	mu.RUnlock()
+	if info == nil {
+		return
+	}
+	updateRecord(name, func(rec *ServiceRecord) { rec.Restarts++ })
+
+	// Unlike stop, don't wait forever: a service failing its liveness probe
+	// may well ignore the IPC stop too
+	mu.Lock()
+	info.stopping = true
+	mu.Unlock()
+	if !sendIPCStop(name) || !waitDone(info, orphanStopWait) {
+		terminate(info.process)
+		if !waitDone(info, orphanStopWait) {
+			info.process.Kill()
+			<-info.done
+		}
+	}
+	mu.Lock()
+	delete(serviceLogs, name)
+	mu.Unlock()
+
+	if err := Start(name); err != nil {
+		updateServiceLog(name, fmt.Sprintf("restart after failed liveness probe (%v) failed: %v", cause, err), true)
+		return
+	}
+	SetLastStatus(name, fmt.Sprintf("restarted after failed liveness probe: %v", cause))
+}
+
+// waitDone waits up to d for a process to exit, reporting whether it did.
+func waitDone(info *processInfo, d time.Duration) bool {
+	select {
+	case <-info.done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// probeStates returns a copy of a service's probe results.
+func probeStates(name string) map[string]ProbeResult {
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(probeResults[name]) == 0 {
+		return nil
+	}
+	states := make(map[string]ProbeResult, len(probeResults[name]))
+	for kind, r := range probeResults[name] {
+		states[kind] = *r
+	}
+	return states
+}
+
+func truncateLine(s string, max int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-3] + "..."
+}
@@ -7,18 +7,29 @@ import (
 	"io"
 	"os"
 	"os/exec"
-	"runtime"
+	"sync"
+	"time"
 
-	"github.com/pink-tools/pink-core"
 	"github.com/pink-tools/pink-otel"
 	"github.com/pink-tools/pink-orchestrator/internal/config"
 	"github.com/pink-tools/pink-orchestrator/internal/registry"
 )
 
 func Start(name string) error {
+	return StartWithEnv(name, nil)
+}
+
+// StartWithEnv starts a service with overrides taking precedence over its
+// env files for this run only.
+func StartWithEnv(name string, overrides map[string]string) error {
 	if !IsInstalled(name) {
 		return fmt.Errorf("service not installed: %s", name)
 	}
+	if Desired(name) == DesiredDisabled {
+		err := fmt.Errorf("service disabled: %s", name)
+		updateServiceLog(name, err.Error(), true)
+		return err
+	}
 
 	ClearLastError(name)
 
@@ -28,6 +39,19 @@ func Start(name string) error {
 		return nil
 	}
 
+	mu.Lock()
+	if startingServices[name] {
+		mu.Unlock()
+		return fmt.Errorf("already starting")
+	}
+	startingServices[name] = true
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		delete(startingServices, name)
+		mu.Unlock()
+	}()
+
 	svc, err := registry.GetService(name)
 	if err != nil {
 		return err
@@ -43,58 +67,143 @@ func Start(name string) error {
 		}
 	}
 
-	// Kill any existing process with same name (from previous session)
-	killExisting(name)
+	// A process from a previous session that wasn't adopted is in the way
+	if rec, err := readPidFile(name); err == nil {
+		if rec.alive() {
+			stopOrphan(name, rec)
+		} else {
+			removePidFile(name)
+		}
+	}
 
 	otel.Info(context.Background(), name, otel.Attr{"status", "starting"})
 	binary := config.ServiceBinary(name)
 
-	var cmd *exec.Cmd
-	// On Unix, if running as root, drop privileges to original user
-	if runtime.GOOS != "windows" && os.Getuid() == 0 {
-		sudoUser := os.Getenv("SUDO_USER")
-		if sudoUser != "" {
-			cmd = exec.Command("sudo", "-E", "-u", sudoUser, binary)
-		} else {
-			cmd = exec.Command(binary)
-		}
-	} else {
-		cmd = exec.Command(binary)
+	// Running as root, services drop to an unprivileged user with a clean environment
+	runAs, err := lookupServiceUser(svc)
+	if err != nil {
+		return startFailed(name, err)
 	}
-	cmd.Dir = core.ServiceDir(name)
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	env, sources, err := buildServiceEnv(name, overrides)
+	if err == nil {
+		env, err = resolveSecrets(runAs.environ(env, sources))
 	}
-	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return fmt.Errorf("failed to create stderr pipe: %w", err)
+		return startFailed(name, err)
+	}
+	args, dir := serviceCommand(svc, env)
+
+	if err := checkServiceEnv(svc, env, dir); err != nil {
+		return startFailed(name, err)
 	}
 
-	cmd.Env = loadServiceEnv(name)
+	var ready *readinessCheck
+	probes, err := newProber(svc, env, runAs)
+	if err == nil {
+		ready, err = prepareReadiness(svc, env, probes)
+	}
+	if err != nil {
+		return startFailed(name, err)
+	}
+	defer ready.release()
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start service: %w", err)
+	limits, err := newLimiter(svc)
+	if err != nil {
+		return startFailed(name, err)
 	}
 
+	runAs.prepareDir(name)
+
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = dir
+	runAs.apply(cmd)
+
 	info := &processInfo{
-		process: cmd.Process,
-		done:    make(chan struct{}),
+		done:      make(chan struct{}),
+		overrides: overrides,
+		detached:  Detached(),
 	}
 
+	// Detached services write to log files that survive the orchestrator
+	var stdout, stderr, outW, errW *os.File
+	if info.detached {
+		logs, err := openServiceLogs(name)
+		if err != nil {
+			return fmt.Errorf("failed to open service logs: %w", err)
+		}
+		defer logs.Close()
+		cmd.Stdout, cmd.Stderr = logs.stdout, logs.stderr
+		detachProcess(cmd)
+		tailServiceLogs(name, info.done)
+	} else {
+		// Plain pipes rather than cmd's, so a retried start can reuse them
+		if stdout, outW, err = os.Pipe(); err != nil {
+			return fmt.Errorf("failed to create stdout pipe: %w", err)
+		}
+		if stderr, errW, err = os.Pipe(); err != nil {
+			stdout.Close()
+			outW.Close()
+			return fmt.Errorf("failed to create stderr pipe: %w", err)
+		}
+		cmd.Stdout, cmd.Stderr = outW, errW
+	}
+
+	cmd.Env = env
+	cmd, err = limits.start(cmd)
+	if !info.detached {
+		// The child has its own copies now
+		outW.Close()
+		errW.Close()
+	}
+	if err != nil {
+		if !info.detached {
+			stdout.Close()
+			stderr.Close()
+		}
+		close(info.done)
+		return startFailed(name, fmt.Errorf("failed to start service: %w", err))
+	}
+	run := RunRecord{Started: time.Now(), PID: cmd.Process.Pid}
+	updateRecord(name, func(rec *ServiceRecord) {
+		rec.Desired = DesiredStarted
+		rec.Starts++
+		rec.LastStarted = run.Started
+	})
+	writePidFile(name, cmd.Process.Pid, info.detached)
+	info.process = cmd.Process
+
 	mu.Lock()
 	runningProcesses[name] = info
 	mu.Unlock()
 
-	go captureOutput(name, stdout, false)
-	go captureOutput(name, stderr, true)
+	var output sync.WaitGroup
+	if !info.detached {
+		output.Add(2)
+		go func() {
+			defer output.Done()
+			defer stdout.Close()
+			captureOutput(name, stdout, false)
+		}()
+		go func() {
+			defer output.Done()
+			defer stderr.Close()
+			captureOutput(name, stderr, true)
+		}()
+	}
 
 	go func() {
+		// Wait closes the pipes: read them to the end first, so the last
+		// stderr lines make it into the run record
+		output.Wait()
 		err := cmd.Wait()
+		limits.release()
+		removePidFile(name)
 		mu.Lock()
 		delete(runningProcesses, name)
+		stopping := info.stopping
 		mu.Unlock()
+		recordExit(name, run, cmd.ProcessState, err, stopping)
 		close(info.done)
 		if err != nil {
 			otel.Warn(context.Background(), name, otel.Attr{"status", "exited"}, otel.Attr{"error", err.Error()})
@@ -103,10 +212,31 @@ func Start(name string) error {
 		}
 	}()
 
+	// Dependents and callers of Start rely on the service being usable
+	// A service that is slow to become ready keeps running under its
+	// probes; liveness decides whether it gets restarted
+	err = ready.wait(info.done)
+	probes.start(info.done, err)
+	if err != nil {
+		otel.Warn(context.Background(), name, otel.Attr{"status", "not ready"}, otel.Attr{"error", err.Error()})
+		updateServiceLog(name, err.Error(), true)
+		return err
+	}
+	otel.Info(context.Background(), name, otel.Attr{"status", "ready"})
+
 	return nil
 }
 
+// Stop stops a service and records that it should stay stopped.
 func Stop(name string) error {
+	if Desired(name) == DesiredStarted {
+		setDesired(name, DesiredStopped)
+	}
+	return stop(name)
+}
+
+// stop stops a service without changing its desired state.
+func stop(name string) error {
 	mu.Lock()
 	info, ok := runningProcesses[name]
 	mu.Unlock()
@@ -116,6 +246,9 @@ func Stop(name string) error {
 	}
 
 	otel.Info(context.Background(), name, otel.Attr{"status", "stopping"})
+	mu.Lock()
+	info.stopping = true
+	mu.Unlock()
 
 	// IPC shutdown - no fallback, if it fails something is wrong
 	if !sendIPCStop(name) {
@@ -134,7 +267,7 @@ func Stop(name string) error {
 
 func Restart(name string) error {
 	otel.Info(context.Background(), name, otel.Attr{"status", "restarting"})
-	if err := Stop(name); err != nil {
+	if err := stop(name); err != nil {
 		return err
 	}
 	return Start(name)
@@ -143,20 +276,26 @@ func Restart(name string) error {
 func captureOutput(name string, r io.Reader, isStderr bool) {
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		line := scanner.Text()
-		if line != "" {
-			otel.PrintServiceLog(line)
-			updateServiceLog(name, line, isStderr)
-		}
+		logLine(name, scanner.Text(), isStderr)
 	}
+	// Keep draining past an overlong line so the service never blocks on a full pipe
+	io.Copy(io.Discard, r)
 }
 
-func killExisting(name string) {
-	if runtime.GOOS == "windows" {
-		exec.Command("taskkill", "/F", "/IM", name+".exe").Run()
-	} else if runtime.GOOS == "darwin" {
-		exec.Command("killall", "-9", name).Run()
-	} else {
-		exec.Command("pkill", "-9", "-x", name).Run()
+func logLine(name, line string, isStderr bool) {
+	if line != "" {
+		otel.PrintServiceLog(line)
+		updateServiceLog(name, line, isStderr)
+		matchLogWatch(name, line)
+		if isStderr {
+			recordStderr(name, line)
+		}
 	}
 }
+
+// startFailed reports a start that never got a process running.
+func startFailed(name string, err error) error {
+	updateServiceLog(name, err.Error(), true)
+	recordStartFailure(name, err)
+	return err
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// processIdentity returns the executable and start time of a live process.
+func processIdentity(pid int) (string, time.Time, error) {
+	exe, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	boot, err := bootTime()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	stat, err := readProcStat(pid, boot)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	// A binary replaced by an update shows as "<path> (deleted)"
+	return strings.TrimSuffix(exe, " (deleted)"), stat.start, nil
+}
+
+// terminate asks a process to exit.
+func terminate(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
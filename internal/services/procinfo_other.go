@@ -0,0 +1,36 @@
+//go:build !linux && !windows
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// processIdentity returns the executable and start time of a live process.
+func processIdentity(pid int) (string, time.Time, error) {
+	out, err := exec.Command("ps", "-o", "lstart=,comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("process %d not found", pid)
+	}
+	// lstart is a fixed five-field date, e.g. "Mon Jan  2 15:04:05 2006"
+	fields := strings.Fields(string(out))
+	if len(fields) < 6 {
+		return "", time.Time{}, fmt.Errorf("unexpected ps output for pid %d", pid)
+	}
+	start, err := time.ParseInLocation(time.ANSIC, strings.Join(fields[:5], " "), time.Local)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return strings.Join(fields[5:], " "), start, nil
+}
+
+// terminate asks a process to exit.
+func terminate(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,45 @@
+//go:build windows
+
+package services
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// processIdentity returns the executable and start time of a live process.
+func processIdentity(pid int) (string, time.Time, error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer windows.CloseHandle(h)
+
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return "", time.Time{}, err
+	}
+	if code != 259 { // STILL_ACTIVE
+		return "", time.Time{}, os.ErrProcessDone
+	}
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(h, 0, &buf[0], &size); err != nil {
+		return "", time.Time{}, err
+	}
+
+	var created, exited, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(h, &created, &exited, &kernel, &user); err != nil {
+		return "", time.Time{}, err
+	}
+	return windows.UTF16ToString(buf[:size]), time.Unix(0, created.Nanoseconds()), nil
+}
+
+// terminate stops a process. Windows has no polite signal for console-less
+// processes, so this is only used after IPC stop has failed.
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
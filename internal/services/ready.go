@@ -0,0 +1,158 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+)
+
+const readyPollInterval = 200 * time.Millisecond
+
+// logWatch latches once a service prints a line matching its pattern.
+type logWatch struct {
+	pattern *regexp.Regexp
+	matched chan struct{}
+	once    sync.Once
+}
+
+// logWatches are consulted by logLine; guarded by mu.
+var logWatches = make(map[string]*logWatch)
+
+// readinessCheck is a started service's readiness, prepared before the
+// process starts so no early output line is missed.
+type readinessCheck struct {
+	name    string
+	timeout time.Duration
+	watch   *logWatch
+	tcp     string
+	http    string
+	probes  *prober // runs the readiness probe, if declared
+}
+
+// prepareReadiness validates svc's readiness settings and starts watching
+// its output. release must be called if wait never is.
+func prepareReadiness(svc *registry.Service, env []string, probes *prober) (*readinessCheck, error) {
+	timeout, err := svc.Readiness.TimeoutDuration()
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := svc.Readiness.LogPattern()
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &readinessCheck{name: svc.Name, timeout: timeout, probes: probes}
+	if r := svc.Readiness; r != nil {
+		rc.tcp = expandVars(r.TCP, svc.Name, env)
+		rc.http = expandVars(r.HTTP, svc.Name, env)
+	}
+	if pattern != nil {
+		rc.watch = &logWatch{pattern: pattern, matched: make(chan struct{})}
+		mu.Lock()
+		logWatches[svc.Name] = rc.watch
+		mu.Unlock()
+	}
+	if rc.usesIPC() {
+		// A port file left by a previous run would look ready at once
+		os.Remove(filepath.Join(config.ServiceDir(svc.Name), svc.Name+".port"))
+	}
+	return rc, nil
+}
+
+func (rc *readinessCheck) release() {
+	mu.Lock()
+	if logWatches[rc.name] == rc.watch {
+		delete(logWatches, rc.name)
+	}
+	mu.Unlock()
+}
+
+// wait blocks until every check passes, the process exits, or the timeout
+// elapses.
+func (rc *readinessCheck) wait(done <-chan struct{}) error {
+	defer rc.release()
+
+	deadline := time.After(rc.timeout)
+	for {
+		pending := rc.pending()
+		if pending == "" {
+			return nil
+		}
+		select {
+		case <-done:
+			if lastErr := GetLastError(rc.name); lastErr != "" {
+				return fmt.Errorf("%s exited before becoming ready: %s", rc.name, lastErr)
+			}
+			return fmt.Errorf("%s exited before becoming ready", rc.name)
+		case <-deadline:
+			return fmt.Errorf("%s not ready after %s: waiting for %s", rc.name, rc.timeout, pending)
+		case <-time.After(readyPollInterval):
+		}
+	}
+}
+
+// pending describes the first check that hasn't passed yet, or "".
+func (rc *readinessCheck) pending() string {
+	if rc.watch != nil {
+		select {
+		case <-rc.watch.matched:
+		default:
+			return fmt.Sprintf("a log line matching %q", rc.watch.pattern)
+		}
+	}
+	if rc.tcp != "" {
+		conn, err := net.DialTimeout("tcp", rc.tcp, time.Second)
+		if err != nil {
+			return "TCP " + rc.tcp
+		}
+		conn.Close()
+	}
+	if rc.http != "" {
+		client := &http.Client{Timeout: 2 * time.Second}
+		resp, err := client.Get(rc.http)
+		if err != nil {
+			return "HTTP " + rc.http
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Sprintf("HTTP %s (got %d)", rc.http, resp.StatusCode)
+		}
+	}
+	if p := rc.probes.readiness(); p != nil {
+		if err := rc.probes.check(p); err != nil {
+			return fmt.Sprintf("the readiness probe (%v)", err)
+		}
+	}
+	if rc.watch == nil && rc.tcp == "" && rc.http == "" && rc.probes.readiness() == nil && !isIPCRunning(rc.name) {
+		return "IPC port file and PING"
+	}
+	return ""
+}
+
+// usesIPC reports whether readiness relies on the IPC port file.
+func (rc *readinessCheck) usesIPC() bool {
+	if p := rc.probes.readiness(); p != nil {
+		return p.Kind == registry.ProbeIPC
+	}
+	return rc.watch == nil && rc.tcp == "" && rc.http == ""
+}
+
+// matchLogWatch latches a service's log watch when line matches it.
+func matchLogWatch(name, line string) {
+	mu.RLock()
+	w := logWatches[name]
+	mu.RUnlock()
+	if w == nil || !w.pattern.MatchString(strings.TrimSpace(line)) {
+		return
+	}
+	w.once.Do(func() { close(w.matched) })
+}
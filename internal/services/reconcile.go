@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pink-tools/pink-otel"
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+)
+
+// Reconciler actions.
+const (
+	ActionInstall   = "install"
+	ActionUninstall = "uninstall"
+	ActionUpdate    = "update"
+	ActionStart     = "start"
+	ActionStop      = "stop"
+)
+
+const (
+	// reconcileBurst actions per service within reconcileWindow are allowed
+	// before the reconciler holds off, so a crash loop can't spin.
+	reconcileBurst  = 5
+	reconcileWindow = 10 * time.Minute
+	// A failed action is retried after a backoff doubling up to the max.
+	reconcileBackoff    = 10 * time.Second
+	reconcileMaxBackoff = 10 * time.Minute
+	eventLogLimit       = 500
+)
+
+// Event is one action the reconciler took or held back.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Service string    `json:"service"`
+	Action  string    `json:"action"`
+	Reason  string    `json:"reason"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// throttle rate-limits the reconciler's actions on one service.
+type throttle struct {
+	recent   []time.Time
+	failures int
+	next     time.Time // no action before this, after a failure
+	held     bool      // the burst limit was hit and logged
+}
+
+var (
+	reconcileMu  sync.Mutex // one pass at a time
+	throttles    = make(map[string]*throttle)
+	eventMu      sync.Mutex
+	shuttingDown bool // guarded by mu
+)
+
+// WatchReconcile enforces desired service states every interval.
+func WatchReconcile(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(interval)
+			Reconcile()
+		}
+	}()
+}
+
+// Reconcile compares each service's desired state with reality and takes
+// at most one action per service to converge them.
+func Reconcile() {
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+
+	svcs, err := registry.ListServices()
+	if err != nil {
+		return
+	}
+	for _, svc := range svcs {
+		if isShuttingDown() {
+			return
+		}
+		rec := Record(svc.Name)
+		if rec == nil || rec.Desired == "" || !svc.Supports(config.Platform()) {
+			continue
+		}
+		if IsInstalling(svc.Name) || IsUpdating(svc.Name) {
+			continue
+		}
+		action, reason := plannedAction(svc, rec)
+		if action == "" || !allowAction(svc.Name, action, reason) {
+			continue
+		}
+
+		otel.Info(context.Background(), svc.Name, otel.Attr{"status", "reconciling"}, otel.Attr{"action", action}, otel.Attr{"reason", reason})
+		err := runAction(svc.Name, action, rec)
+		actionDone(svc.Name, err)
+
+		event := Event{Time: time.Now(), Service: svc.Name, Action: action, Reason: reason}
+		if err != nil {
+			event.Error = err.Error()
+			otel.Warn(context.Background(), svc.Name, otel.Attr{"status", action + " failed"}, otel.Attr{"error", err.Error()})
+		}
+		logEvent(event)
+	}
+}
+
+// plannedAction is the next step towards a service's desired state, or "".
+func plannedAction(svc registry.Service, rec *ServiceRecord) (action, reason string) {
+	installed := IsInstalled(svc.Name)
+	if rec.Desired == DesiredAbsent {
+		if installed {
+			return ActionUninstall, "desired absent"
+		}
+		return "", ""
+	}
+	if !installed {
+		// A stopped or disabled service that went missing was most likely
+		// removed on purpose
+		if rec.Desired == DesiredStarted {
+			return ActionInstall, "not installed"
+		}
+		return "", ""
+	}
+	if rec.Pin != "" {
+		version := rec.Version
+		if version == "" {
+			version = GetInstalledVersion(svc.Name)
+		}
+		if !sameVersion(version, rec.Pin) {
+			return ActionUpdate, fmt.Sprintf("installed %s, pinned at %s", version, rec.Pin)
+		}
+	}
+	if svc.Type != "daemon" {
+		return "", ""
+	}
+
+	running := GetStatus(svc.Name).Status == StatusRunning
+	switch {
+	case rec.Desired == DesiredStarted && !running:
+		return ActionStart, "not running"
+	case rec.Desired != DesiredStarted && running:
+		return ActionStop, "desired " + rec.Desired
+	}
+	return "", ""
+}
+
+func runAction(name, action string, rec *ServiceRecord) error {
+	progress := func(msg string) { SetLastStatus(name, msg) }
+	switch action {
+	case ActionInstall:
+		return InstallVersion(name, rec.Pin, progress)
+	case ActionUninstall:
+		return Uninstall(name)
+	case ActionUpdate:
+		return (&installer{progress: progress}).replace(name, rec.Pin)
+	case ActionStart:
+		return Start(name)
+	case ActionStop:
+		return stop(name)
+	}
+	return fmt.Errorf("unknown action: %s", action)
+}
+
+// allowAction applies the failure backoff and burst limit.
+func allowAction(name, action, reason string) bool {
+	now := time.Now()
+	t := throttles[name]
+	if t == nil {
+		t = &throttle{}
+		throttles[name] = t
+	}
+	if now.Before(t.next) {
+		return false
+	}
+
+	recent := t.recent[:0]
+	for _, at := range t.recent {
+		if now.Sub(at) < reconcileWindow {
+			recent = append(recent, at)
+		}
+	}
+	t.recent = recent
+	if len(t.recent) >= reconcileBurst {
+		if !t.held {
+			t.held = true
+			logEvent(Event{Time: now, Service: name, Action: action, Reason: reason,
+				Error: fmt.Sprintf("rate limited: %d actions in %s", len(t.recent), reconcileWindow)})
+		}
+		return false
+	}
+	t.held = false
+	t.recent = append(t.recent, now)
+	return true
+}
+
+func actionDone(name string, err error) {
+	t := throttles[name]
+	if err == nil {
+		t.failures = 0
+		t.next = time.Time{}
+		return
+	}
+	t.failures++
+	backoff := reconcileBackoff << (t.failures - 1)
+	if backoff > reconcileMaxBackoff || backoff <= 0 {
+		backoff = reconcileMaxBackoff
+	}
+	t.next = time.Now().Add(backoff)
+}
+
+func isShuttingDown() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return shuttingDown
+}
+
+// sameVersion compares versions ignoring a leading "v".
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
+
+func logEvent(e Event) {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	appendJSONLine(config.EventLogFile(), e, eventLogLimit)
+}
+
+// Events returns logged reconciler events, newest first, only those of
+// service when it is not empty, at most limit when limit > 0.
+func Events(service string, limit int) ([]Event, error) {
+	eventMu.Lock()
+	lines, err := readJSONLines(config.EventLogFile())
+	eventMu.Unlock()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+
+	var events []Event
+	for i := len(lines) - 1; i >= 0; i-- {
+		var e Event
+		if err := json.Unmarshal(lines[i], &e); err != nil {
+			continue
+		}
+		if service != "" && e.Service != service {
+			continue
+		}
+		events = append(events, e)
+		if limit > 0 && len(events) == limit {
+			break
+		}
+	}
+	return events, nil
+}
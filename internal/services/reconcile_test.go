@@ -0,0 +1,44 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+)
+
+func TestPlannedAction(t *testing.T) {
+	tests := []struct {
+		name      string
+		service   string
+		rec       ServiceRecord
+		installed bool
+		running   bool
+		want      string
+	}{
+		{"absent installed", "svc-daemon", ServiceRecord{Desired: DesiredAbsent}, true, false, ActionUninstall},
+		{"absent missing", "svc-daemon", ServiceRecord{Desired: DesiredAbsent}, false, false, ""},
+		{"started missing", "svc-daemon", ServiceRecord{Desired: DesiredStarted}, false, false, ActionInstall},
+		{"stopped missing", "svc-daemon", ServiceRecord{Desired: DesiredStopped}, false, false, ""},
+		{"disabled missing", "svc-daemon", ServiceRecord{Desired: DesiredDisabled}, false, false, ""},
+		{"pin differs", "svc-daemon", ServiceRecord{Desired: DesiredStopped, Version: "v1.0.0", Pin: "v2.0.0"}, true, false, ActionUpdate},
+		{"pin matches", "svc-daemon", ServiceRecord{Desired: DesiredStopped, Version: "1.0.0", Pin: "v1.0.0"}, true, false, ""},
+		{"started stopped", "svc-daemon", ServiceRecord{Desired: DesiredStarted}, true, false, ActionStart},
+		{"started running", "svc-daemon", ServiceRecord{Desired: DesiredStarted}, true, true, ""},
+		{"stopped running", "svc-daemon", ServiceRecord{Desired: DesiredStopped}, true, true, ActionStop},
+		{"disabled running", "svc-daemon", ServiceRecord{Desired: DesiredDisabled}, true, true, ActionStop},
+		{"cli started", "svc-cli", ServiceRecord{Desired: DesiredStarted}, true, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeService(t, tt.service, nil, tt.installed, tt.running)
+			svc, err := registry.GetService(tt.service)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := tt.rec
+			if got, reason := plannedAction(*svc, &rec); got != tt.want {
+				t.Errorf("plannedAction() = %q (%s), want %q", got, reason, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+)
+
+// Report is the orchestrator-wide status served over the API.
+type Report struct {
+	Version         string          `json:"version"`
+	RegistryVersion int             `json:"registry_version,omitempty"`
+	Warning         string          `json:"warning,omitempty"`
+	Services        []ServiceReport `json:"services"`
+}
+
+// ServiceReport is the status of a single registry service.
+type ServiceReport struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	ServiceState
+	// History holds recent usage samples; only reported for a named service
+	History []Usage `json:"history,omitempty"`
+	// Record is what the orchestrator keeps about the service across restarts
+	Record *ServiceRecord `json:"record,omitempty"`
+}
+
+// GetReport collects the status of every registry service, or only of
+// the named one when name is not empty.
+func GetReport(name string) (Report, error) {
+	report := Report{
+		Version: orchestratorVersion,
+		Warning: registry.Warning(),
+	}
+
+	reg, err := registry.Load()
+	if err != nil {
+		return report, err
+	}
+	report.RegistryVersion = reg.Version
+
+	// Resolved for this platform and the local overlay, as services are run
+	svcs, err := registry.ListServices()
+	if err != nil {
+		return report, err
+	}
+
+	found := false
+	for _, svc := range svcs {
+		if name != "" && svc.Name != name {
+			continue
+		}
+		found = true
+
+		state := GetStatus(svc.Name)
+		if !svc.Supports(config.Platform()) {
+			// Only listed when asked for by name
+			if name == "" {
+				continue
+			}
+			state.Status = StatusUnsupported
+		}
+		if state.Status != StatusNotInstalled && svc.Type == "daemon" {
+			runAs, _ := lookupServiceUser(&svc)
+			env, sources, _ := buildServiceEnv(svc.Name, nil)
+			args, dir := serviceCommand(&svc, maskSecretEnv(svc.Name, runAs.environ(env, sources)))
+			state.Command = formatCommandLine(config.ServiceBinary(svc.Name), args)
+			state.WorkDir = dir
+			state.User = runAs.String()
+			if run := LastExit(svc.Name); run != nil {
+				// Status needs no token; the stderr tail is in the history
+				run.Stderr = nil
+				state.LastExit = run
+			}
+		}
+		state.LastStatus = GetLastStatus(svc.Name)
+		state.LastError = GetLastError(svc.Name)
+		sr := ServiceReport{
+			Name:         svc.Name,
+			Type:         svc.Type,
+			ServiceState: state,
+			Record:       Record(svc.Name),
+		}
+		if state.Status == StatusRunning {
+			sr.Usage = CurrentUsage(svc.Name)
+			if name != "" {
+				sr.History = UsageHistory(svc.Name)
+			}
+		}
+		report.Services = append(report.Services, sr)
+	}
+
+	if name != "" && !found {
+		return report, fmt.Errorf("service not found: %s", name)
+	}
+
+	return report, nil
+}
+
+// maskSecretEnv masks the values of name's secret variables in env, so a
+// command line shown without a token doesn't reveal them.
+func maskSecretEnv(name string, env []string) []string {
+	for key, ev := range declaredEnv(name) {
+		if v, ok := lookupEnv(env, key); ok && v != "" && ev.IsSecret() {
+			env = append(env, key+"="+secretMask)
+		}
+	}
+	return env
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReportMasksSecretArgs(t *testing.T) {
+	fakeService(t, "svc-daemon", &ServiceRecord{Desired: DesiredStopped}, true, false)
+	if err := SetEnv("svc-daemon", map[string]string{"TOKEN": "t0ken", "REGION": "eu"}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := GetReport("svc-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	command := report.Services[0].Command
+	if strings.Contains(command, "t0ken") || !strings.Contains(command, "--token "+secretMask) {
+		t.Errorf("Command = %q, want the token masked", command)
+	}
+	if !strings.Contains(command, "--region eu") {
+		t.Errorf("Command = %q, want other variables expanded", command)
+	}
+}
@@ -0,0 +1,210 @@
+//go:build !windows
+
+package services
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+)
+
+// serviceUser is the account a service process runs as.
+type serviceUser struct {
+	name   string
+	home   string
+	uid    uint32
+	gid    uint32
+	groups []uint32
+}
+
+// System variables a service keeps after dropping privileges; everything
+// else it gets comes from the env files and overrides.
+var passthroughEnv = map[string]bool{
+	"PATH": true, "SHELL": true, "TERM": true, "TZ": true,
+	"LANG": true, "LANGUAGE": true,
+	"DISPLAY": true, "WAYLAND_DISPLAY": true, "XAUTHORITY": true,
+	"DBUS_SESSION_BUS_ADDRESS": true, "PULSE_SERVER": true,
+	"PINK_LOG_WIDTH": true,
+}
+
+// lookupServiceUser resolves the account for svc: its run_as setting, else
+// the user who invoked sudo, else the owner of the home directory. It
+// returns nil when the service simply runs as the orchestrator's user.
+func lookupServiceUser(svc *registry.Service) (*serviceUser, error) {
+	spec := svc.RunAs
+	if os.Getuid() != 0 {
+		if spec != "" {
+			if cur, err := user.Current(); err != nil || cur.Username != strings.Split(spec, ":")[0] {
+				return nil, fmt.Errorf("run_as %s requires the orchestrator to run as root", spec)
+			}
+		}
+		return nil, nil
+	}
+
+	if spec == "" {
+		spec = os.Getenv("SUDO_USER")
+	}
+	if spec == "" {
+		if info, err := os.Stat(config.HomeDir()); err == nil {
+			if st, ok := info.Sys().(*syscall.Stat_t); ok && st.Uid != 0 {
+				spec = strconv.Itoa(int(st.Uid))
+			}
+		}
+	}
+	if spec == "" {
+		return nil, fmt.Errorf("refusing to run %s as root: set run_as (run_as: root to allow)", svc.Name)
+	}
+
+	userName, groupName, _ := strings.Cut(spec, ":")
+	u, err := user.Lookup(userName)
+	if err != nil {
+		if u, err = user.LookupId(userName); err != nil {
+			return nil, fmt.Errorf("run_as: unknown user %s", userName)
+		}
+	}
+
+	su := &serviceUser{name: u.Username, home: u.HomeDir}
+	uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+	gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+	su.uid, su.gid = uint32(uid), uint32(gid)
+
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return nil, fmt.Errorf("run_as: unknown group %s", groupName)
+			}
+		}
+		gid, _ := strconv.ParseUint(g.Gid, 10, 32)
+		su.gid = uint32(gid)
+	}
+
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if gid, err := strconv.ParseUint(id, 10, 32); err == nil {
+				su.groups = append(su.groups, uint32(gid))
+			}
+		}
+	}
+
+	return su, nil
+}
+
+// apply makes cmd start as the user. Running as root needs no switch.
+func (u *serviceUser) apply(cmd *exec.Cmd) {
+	if u == nil || u.uid == 0 {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    u.uid,
+		Gid:    u.gid,
+		Groups: u.groups,
+	}
+}
+
+// environ replaces the orchestrator's environment with a clean one for the
+// user: passthrough system variables, the user's identity, and every
+// variable set by env files or overrides (sources).
+func (u *serviceUser) environ(env []string, sources map[string]string) []string {
+	if u == nil {
+		return env
+	}
+
+	clean := []string{
+		"HOME=" + u.home,
+		"USER=" + u.name,
+		"LOGNAME=" + u.name,
+	}
+	runtimeDir := fmt.Sprintf("/run/user/%d", u.uid)
+	if _, err := os.Stat(runtimeDir); err == nil {
+		clean = append(clean, "XDG_RUNTIME_DIR="+runtimeDir)
+	}
+
+	for _, e := range env {
+		key, _, _ := strings.Cut(e, "=")
+		if sources[key] != "" || passthroughEnv[key] || strings.HasPrefix(key, "LC_") {
+			clean = append(clean, e)
+		}
+	}
+	return clean
+}
+
+// prepareDir lets the user write the files a service keeps in its
+// directory: the IPC port file and data it already has there. The directory
+// itself, the binary and other executables stay root-owned, along with the
+// directories leading to them, because root runs them too: the orchestrator
+// for --version and commands linked into BinDir. A user owning any of those
+// could rename the program away and put another in its place.
+func (u *serviceUser) prepareDir(name string) {
+	if u == nil || u.uid == 0 || os.Getuid() != 0 {
+		return
+	}
+	dir := config.ServiceDir(name)
+	binary := config.ServiceBinary(name)
+
+	// pink-core rewrites the port file in place, which needs no write access
+	// to the directory
+	portFile := filepath.Join(dir, name+".port")
+	if f, err := os.OpenFile(portFile, os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+		f.Close()
+	}
+
+	keep := map[string]bool{dir: true}
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if path == binary || path == binary+".old" || info.Mode()&0111 != 0 {
+			keep[path] = true
+			for p := filepath.Dir(path); !keep[p]; p = filepath.Dir(p) {
+				keep[p] = true
+			}
+		}
+		return nil
+	})
+
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		switch {
+		case keep[path] && st.Uid != 0:
+			// Handed out by earlier versions
+			os.Lchown(path, 0, 0)
+		case !keep[path] && st.Uid == 0:
+			os.Lchown(path, int(u.uid), int(u.gid))
+		}
+		return nil
+	})
+}
+
+func (u *serviceUser) String() string {
+	if u == nil {
+		return ""
+	}
+	return u.name
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package services
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+)
+
+// serviceUser is unused on Windows: services run as the orchestrator's user.
+type serviceUser struct{}
+
+func lookupServiceUser(svc *registry.Service) (*serviceUser, error) {
+	if svc.RunAs != "" {
+		return nil, fmt.Errorf("run_as is not supported on Windows")
+	}
+	return nil, nil
+}
+
+func (u *serviceUser) apply(cmd *exec.Cmd) {}
+
+func (u *serviceUser) environ(env []string, sources map[string]string) []string {
+	return env
+}
+
+func (u *serviceUser) prepareDir(name string) {}
+
+func (u *serviceUser) String() string {
+	return ""
+}
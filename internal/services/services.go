@@ -14,6 +14,7 @@ const (
 	StatusStopped      Status = "stopped"
 	StatusRunning      Status = "running"
 	StatusError        Status = "error"
+	StatusUnsupported  Status = "unsupported"
 )
 
 type ServiceState struct {
@@ -21,11 +22,23 @@ type ServiceState struct {
 	LastStatus string `json:"last_status"`
 	LastError  string `json:"last_error"`
 	PID        int    `json:"pid,omitempty"`
+	Adopted    bool   `json:"adopted,omitempty"`
+	Command    string `json:"command,omitempty"`
+	WorkDir    string `json:"workdir,omitempty"`
+	User       string `json:"user,omitempty"`
+	Usage      *Usage `json:"usage,omitempty"`
+
+	Probes   map[string]ProbeResult `json:"probes,omitempty"`
+	LastExit *RunRecord             `json:"last_exit,omitempty"`
 }
 
 type processInfo struct {
-	process *os.Process
-	done    chan struct{}
+	process   *os.Process
+	done      chan struct{}
+	overrides map[string]string
+	adopted   bool // started by a previous orchestrator session
+	detached  bool // outlives the orchestrator, logging to files
+	stopping  bool // Stop was requested, so an exit is not a crash
 }
 
 var (
@@ -33,6 +46,8 @@ var (
 	serviceLogs        = make(map[string]*ServiceState)
 	runningProcesses   = make(map[string]*processInfo)
 	installingServices = make(map[string]bool)
+	updatingServices   = make(map[string]bool)
+	startingServices   = make(map[string]bool)
 	onStatusUpdate     func()
 )
 
@@ -71,10 +86,14 @@ func GetStatus(name string) ServiceState {
 			// Process still running
 			state.Status = StatusRunning
 			state.PID = info.process.Pid
+			state.Adopted = info.adopted
 		}
 	}
 	mu.RUnlock()
 
+	if state.Status == StatusRunning {
+		state.Probes = probeStates(name)
+	}
 	return state
 }
 
@@ -84,6 +103,13 @@ func IsInstalled(name string) bool {
 	return err == nil
 }
 
+// IsUpdating reports whether a service's binary is being replaced.
+func IsUpdating(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return updatingServices[name]
+}
+
 func IsInstalling(name string) bool {
 	mu.RLock()
 	defer mu.RUnlock()
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/pink-tools/pink-orchestrator/internal/config"
+)
+
+// testRegistry is the registry the tests run against, cached as if fetched.
+const testRegistry = `version: 1
+services:
+  - name: svc-daemon
+    repo: example/svc-daemon
+    type: daemon
+    args: ["--token", "${TOKEN}", "--region", "${REGION}"]
+    env_vars:
+      - name: TOKEN
+        type: secret
+  - name: svc-other
+    repo: example/svc-other
+    type: daemon
+  - name: svc-cli
+    repo: example/svc-cli
+    type: cli
+    env_vars:
+      - name: API_KEY
+        type: secret
+`
+
+// TestMain runs the tests in user mode under a temporary data home, so
+// they touch neither the machine's services nor the network.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "pink-orchestrator-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("ORCHESTRATOR_USER_MODE", "1")
+	os.Setenv("XDG_DATA_HOME", dir)
+	os.Setenv("HOME", dir)
+	os.Unsetenv("ORCHESTRATOR_REGISTRY_URL")
+	os.MkdirAll(config.OrchestratorDir(), 0755)
+	os.WriteFile(config.RegistryCacheFile(), []byte(testRegistry), 0644)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fakeService sets up a test service: its record, an installed binary and
+// a running process, all undone when the test ends.
+func fakeService(t *testing.T, name string, rec *ServiceRecord, installed, running bool) {
+	t.Helper()
+	if rec != nil {
+		c := *rec
+		updateRecord(name, func(r *ServiceRecord) { *r = c })
+	}
+	if installed {
+		if err := os.WriteFile(config.ServiceBinary(name), nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if running {
+		self, _ := os.FindProcess(os.Getpid())
+		mu.Lock()
+		runningProcesses[name] = &processInfo{done: make(chan struct{}), process: self}
+		mu.Unlock()
+	}
+	t.Cleanup(func() {
+		stateMu.Lock()
+		delete(state.Services, name)
+		stateMu.Unlock()
+		mu.Lock()
+		delete(runningProcesses, name)
+		mu.Unlock()
+		os.RemoveAll(config.ServiceDir(name))
+	})
+}
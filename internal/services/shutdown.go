@@ -1,13 +1,33 @@
 package services
 
-import "github.com/pink-tools/pink-orchestrator/internal/registry"
+import (
+	"context"
 
-// Shutdown stops all running services
+	"github.com/pink-tools/pink-otel"
+	"github.com/pink-tools/pink-orchestrator/internal/registry"
+)
+
+// Shutdown stops the reconciler and all running services. In detach mode,
+// services started detached are left running for the next orchestrator to
+// reattach.
 func Shutdown() {
+	mu.Lock()
+	shuttingDown = true
+	mu.Unlock()
+
+	detach := Detached()
 	svcs, _ := registry.ListServices()
 	for _, svc := range svcs {
-		if GetStatus(svc.Name).Status == StatusRunning {
-			Stop(svc.Name)
+		if GetStatus(svc.Name).Status != StatusRunning {
+			continue
+		}
+		mu.RLock()
+		info := runningProcesses[svc.Name]
+		mu.RUnlock()
+		if detach && info != nil && info.detached {
+			otel.Info(context.Background(), svc.Name, otel.Attr{"status", "left running"})
+			continue
 		}
+		stop(svc.Name)
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -17,49 +18,145 @@ import (
 	"golang.org/x/mod/semver"
 )
 
+// stateVersion is the schema version of the state file. Files written by
+// older versions are migrated on load.
+const stateVersion = 2
+
+// Desired states of a service.
+const (
+	DesiredStarted  = "started"  // started again when the orchestrator starts
+	DesiredStopped  = "stopped"  // enabled, but not running
+	DesiredDisabled = "disabled" // refuses to start until enabled again
+	DesiredAbsent   = "absent"   // uninstalled
+)
+
+// State is what the orchestrator persists across restarts.
 type State struct {
-	RunningServices []string `json:"running_services"`
+	Version  int                       `json:"version"`
+	Detach   bool                      `json:"detach,omitempty"`
+	Services map[string]*ServiceRecord `json:"services,omitempty"`
+
+	// RunningServices is the version 1 list of services to restore.
+	RunningServices []string `json:"running_services,omitempty"`
+}
+
+// ServiceRecord is the persisted state of one service.
+type ServiceRecord struct {
+	Desired         string    `json:"desired,omitempty"`
+	Version         string    `json:"version,omitempty"` // installed version
+	InstalledAt     time.Time `json:"installed_at,omitzero"`
+	Pin             string    `json:"pin,omitempty"` // updates are skipped while set
+	LastUpdateCheck time.Time `json:"last_update_check,omitzero"`
+	LatestVersion   string    `json:"latest_version,omitempty"`
+	Starts          int       `json:"starts,omitempty"`
+	Crashes         int       `json:"crashes,omitempty"`
+	Restarts        int       `json:"restarts,omitempty"` // after failed liveness probes
+	LastStarted     time.Time `json:"last_started,omitzero"`
+}
+
+// stateMigrations[i] upgrades a state from version i+1 to i+2.
+var stateMigrations = []func(*State){
+	migrateStateV1,
+}
+
+// migrateStateV1 turns the list of running services into desired states.
+func migrateStateV1(s *State) {
+	for _, name := range s.RunningServices {
+		s.record(name).Desired = DesiredStarted
+	}
+	s.RunningServices = nil
+}
+
+// migrateState upgrades an older state to stateVersion. A state without a
+// version is version 1.
+func migrateState(s *State) error {
+	if s.Version == 0 {
+		s.Version = 1
+	}
+	if s.Version < 0 || s.Version > stateVersion {
+		return fmt.Errorf("unsupported state version %d", s.Version)
+	}
+	for s.Version < stateVersion {
+		stateMigrations[s.Version-1](s)
+		s.Version++
+	}
+	return nil
 }
 
 var (
 	stateMu     sync.Mutex
-	state       = &State{}
+	state       = &State{Version: stateVersion}
 	stateLoaded bool
+	// stateNewer is set when the state file comes from a newer orchestrator;
+	// it is then never overwritten.
+	stateNewer bool
 )
 
+func (s *State) record(name string) *ServiceRecord {
+	if s.Services == nil {
+		s.Services = make(map[string]*ServiceRecord)
+	}
+	rec := s.Services[name]
+	if rec == nil {
+		rec = &ServiceRecord{}
+		s.Services[name] = rec
+	}
+	return rec
+}
+
 func loadState() {
 	if stateLoaded {
 		return
 	}
+	stateLoaded = true
 	data, err := os.ReadFile(config.StateFile())
 	if err != nil {
-		stateLoaded = true
 		return
 	}
-	if err := json.Unmarshal(data, state); err != nil {
+	loaded := &State{}
+	if err := json.Unmarshal(data, loaded); err != nil {
 		otel.Warn(context.Background(), "failed to parse state file", otel.Attr{"error", err.Error()})
+		return
 	}
-	stateLoaded = true
-}
-
-func SaveState() error {
-	services, err := registry.ListServices()
-	if err != nil {
-		return fmt.Errorf("failed to list services: %w", err)
+	if loaded.Version == 0 {
+		loaded.Version = 1
+	}
+	if loaded.Version > stateVersion {
+		otel.Warn(context.Background(), "state file is from a newer orchestrator, not saving changes",
+			otel.Attr{"version", loaded.Version}, otel.Attr{"supported", stateVersion})
+		stateNewer = true
+		state = loaded
+		return
 	}
 
-	var running []string
-	for _, svc := range services {
-		if GetStatus(svc.Name).Status == StatusRunning {
-			running = append(running, svc.Name)
+	version := loaded.Version
+	if err := migrateState(loaded); err != nil {
+		otel.Warn(context.Background(), "failed to parse state file", otel.Attr{"error", err.Error()})
+		return
+	}
+	state = loaded
+	if version < stateVersion {
+		// Keep the original in case the migration needs to be undone
+		os.WriteFile(fmt.Sprintf("%s.v%d", config.StateFile(), version), data, 0644)
+		if err := saveStateLocked(); err != nil {
+			otel.Warn(context.Background(), "failed to save migrated state", otel.Attr{"error", err.Error()})
 		}
 	}
+}
 
+// SaveState writes the state file.
+func SaveState() error {
 	stateMu.Lock()
-	state.RunningServices = running
-	data, err := json.MarshalIndent(state, "", "  ")
-	stateMu.Unlock()
+	defer stateMu.Unlock()
+	loadState()
+	return saveStateLocked()
+}
 
+func saveStateLocked() error {
+	if stateNewer {
+		return fmt.Errorf("state file is from a newer orchestrator")
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -80,14 +177,105 @@ func SaveState() error {
 	return nil
 }
 
+// updateRecord changes a service record and saves the state.
+func updateRecord(name string, change func(*ServiceRecord)) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	loadState()
+	change(state.record(name))
+	if err := saveStateLocked(); err != nil {
+		otel.Warn(context.Background(), name, otel.Attr{"status", "failed to save state"}, otel.Attr{"error", err.Error()})
+	}
+}
+
+// Record returns a copy of a service's persisted state, or nil.
+func Record(name string) *ServiceRecord {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	loadState()
+	rec, ok := state.Services[name]
+	if !ok {
+		return nil
+	}
+	c := *rec
+	return &c
+}
+
+// Desired returns a service's desired state, DesiredStopped by default.
+func Desired(name string) string {
+	if rec := Record(name); rec != nil && rec.Desired != "" {
+		return rec.Desired
+	}
+	return DesiredStopped
+}
+
+func setDesired(name, desired string) {
+	updateRecord(name, func(rec *ServiceRecord) { rec.Desired = desired })
+}
+
+// Enable lets a disabled service start again; it is left stopped.
+func Enable(name string) error {
+	if _, err := registry.GetService(name); err != nil {
+		return err
+	}
+	if Desired(name) == DesiredDisabled {
+		setDesired(name, DesiredStopped)
+	}
+	return nil
+}
+
+// Disable stops a service and keeps it from starting, including as a
+// dependency, until it is enabled again.
+func Disable(name string) error {
+	if _, err := registry.GetService(name); err != nil {
+		return err
+	}
+	setDesired(name, DesiredDisabled)
+	return stop(name)
+}
+
+// Pin holds a service at version, or at the installed version when
+// version is empty: updates skip it until Unpin.
+func Pin(name, version string) error {
+	if _, err := registry.GetService(name); err != nil {
+		return err
+	}
+	if version == "" {
+		version = GetInstalledVersion(name)
+		if version == "" {
+			return fmt.Errorf("%s is not installed, give a version to pin", name)
+		}
+	}
+	updateRecord(name, func(rec *ServiceRecord) { rec.Pin = version })
+	return nil
+}
+
+// Unpin lets updates reach a service again.
+func Unpin(name string) error {
+	if _, err := registry.GetService(name); err != nil {
+		return err
+	}
+	updateRecord(name, func(rec *ServiceRecord) { rec.Pin = "" })
+	return nil
+}
+
+// RestoreState starts the services whose desired state is started.
 func RestoreState() {
 	stateMu.Lock()
 	loadState()
-	toStart := make([]string, len(state.RunningServices))
-	copy(toStart, state.RunningServices)
+	var toStart []string
+	for name, rec := range state.Services {
+		if rec.Desired == DesiredStarted {
+			toStart = append(toStart, name)
+		}
+	}
 	stateMu.Unlock()
+	sort.Strings(toStart)
 
 	for _, name := range toStart {
+		if !IsInstalled(name) {
+			continue
+		}
 		if err := Start(name); err != nil {
 			otel.Warn(context.Background(), "failed to restore service", otel.Attr{"service", name}, otel.Attr{"error", err.Error()})
 		}
@@ -188,6 +376,11 @@ func isNewer(latest, installed string) bool {
 }
 
 func CheckUpdate(name string) (hasUpdate bool, installed, latest string, err error) {
+	return checkUpdate(name, true)
+}
+
+// checkUpdate is CheckUpdate; record keeps the latest version in the state.
+func checkUpdate(name string, record bool) (hasUpdate bool, installed, latest string, err error) {
 	svc, err := registry.GetService(name)
 	if err != nil {
 		return false, "", "", err
@@ -203,5 +396,19 @@ func CheckUpdate(name string) (hasUpdate bool, installed, latest string, err err
 		return false, installed, "", err
 	}
 
+	pinned := false
+	if record {
+		updateRecord(name, func(rec *ServiceRecord) {
+			rec.LastUpdateCheck = time.Now()
+			rec.LatestVersion = latest
+			pinned = rec.Pin != ""
+		})
+	} else if rec := Record(name); rec != nil {
+		pinned = rec.Pin != ""
+	}
+	if pinned {
+		return false, installed, latest, nil
+	}
+
 	return isNewer(latest, installed), installed, latest, nil
 }
@@ -0,0 +1,44 @@
+package services
+
+import "testing"
+
+func TestMigrateState(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      State
+		wantErr bool
+		desired map[string]string
+	}{
+		{"unversioned", State{RunningServices: []string{"a"}}, false, map[string]string{"a": DesiredStarted}},
+		{"v1", State{Version: 1, RunningServices: []string{"a", "b"}}, false, map[string]string{"a": DesiredStarted, "b": DesiredStarted}},
+		{"current", State{Version: stateVersion, Services: map[string]*ServiceRecord{"a": {Desired: DesiredStopped}}}, false, map[string]string{"a": DesiredStopped}},
+		{"negative", State{Version: -1}, true, nil},
+		{"future", State{Version: stateVersion + 1}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.in
+			err := migrateState(&s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("migrateState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if s.Version != stateVersion {
+				t.Errorf("Version = %d, want %d", s.Version, stateVersion)
+			}
+			if s.RunningServices != nil {
+				t.Errorf("RunningServices = %v, want nil", s.RunningServices)
+			}
+			if len(s.Services) != len(tt.desired) {
+				t.Errorf("got %d services, want %d", len(s.Services), len(tt.desired))
+			}
+			for name, want := range tt.desired {
+				if rec := s.Services[name]; rec == nil || rec.Desired != want {
+					t.Errorf("%s: desired = %v, want %s", name, rec, want)
+				}
+			}
+		})
+	}
+}
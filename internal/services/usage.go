@@ -0,0 +1,171 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// UsageInterval is how often running services are sampled.
+	UsageInterval = 5 * time.Second
+	// usageHistory is how many samples are kept per service.
+	usageHistory = 60
+)
+
+// Usage is a resource sample of a service process and its descendants.
+type Usage struct {
+	Time     time.Time `json:"time"`
+	CPU      float64   `json:"cpu"` // percent of one core since the previous sample
+	RSS      uint64    `json:"rss"` // resident memory in bytes
+	Threads  int       `json:"threads"`
+	FDs      int       `json:"fds"`
+	Children int       `json:"children"`
+	Uptime   int64     `json:"uptime"` // seconds since the service started
+
+	pid     int
+	cpuTime time.Duration
+}
+
+func (u Usage) String() string {
+	return fmt.Sprintf("%.1f%% CPU, %s, %d threads, up %s",
+		u.CPU, formatBytes(int64(u.RSS)), u.Threads, FormatUptime(u.Uptime))
+}
+
+// procStat is one process read from the OS process table.
+type procStat struct {
+	ppid    int
+	cpu     time.Duration
+	rss     uint64
+	threads int
+	start   time.Time
+}
+
+var (
+	usageMu sync.RWMutex
+	usage   = make(map[string][]Usage)
+)
+
+// WatchUsage samples running services every interval.
+func WatchUsage(interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			if sampleUsage() {
+				notifyStatusUpdate()
+			}
+		}
+	}()
+}
+
+// CurrentUsage returns the latest sample of a running service, or nil.
+func CurrentUsage(name string) *Usage {
+	usageMu.RLock()
+	defer usageMu.RUnlock()
+	hist := usage[name]
+	if len(hist) == 0 {
+		return nil
+	}
+	u := hist[len(hist)-1]
+	return &u
+}
+
+// UsageHistory returns the recent samples of a running service, oldest first.
+func UsageHistory(name string) []Usage {
+	usageMu.RLock()
+	defer usageMu.RUnlock()
+	return append([]Usage(nil), usage[name]...)
+}
+
+// sampleUsage records a sample for every running service. It returns false
+// when the platform has no process table to sample.
+func sampleUsage() bool {
+	mu.RLock()
+	pids := make(map[string]int, len(runningProcesses))
+	for name, info := range runningProcesses {
+		pids[name] = info.process.Pid
+	}
+	mu.RUnlock()
+
+	procs, err := readProcTable()
+	if err != nil {
+		return false
+	}
+	children := make(map[int][]int)
+	for pid, p := range procs {
+		children[p.ppid] = append(children[p.ppid], pid)
+	}
+
+	now := time.Now()
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	for name, pid := range pids {
+		root, ok := procs[pid]
+		if !ok {
+			continue
+		}
+		u := Usage{Time: now, Uptime: int64(now.Sub(root.start).Seconds()), pid: pid}
+		tree := descendants(pid, children)
+		for _, p := range tree {
+			proc := procs[p]
+			u.cpuTime += proc.cpu
+			u.RSS += proc.rss
+			u.Threads += proc.threads
+			u.FDs += countFDs(p)
+		}
+		u.Children = len(tree) - 1
+
+		hist := usage[name]
+		if n := len(hist); n > 0 && hist[n-1].pid == pid {
+			// Children that exited since take their CPU time with them
+			prev := hist[n-1]
+			if elapsed := now.Sub(prev.Time); elapsed > 0 && u.cpuTime >= prev.cpuTime {
+				u.CPU = float64(u.cpuTime-prev.cpuTime) / float64(elapsed) * 100
+			}
+		} else {
+			hist = nil
+		}
+		hist = append(hist, u)
+		if len(hist) > usageHistory {
+			hist = hist[len(hist)-usageHistory:]
+		}
+		usage[name] = hist
+	}
+
+	for name := range usage {
+		if _, ok := pids[name]; !ok {
+			delete(usage, name)
+		}
+	}
+	return true
+}
+
+// descendants returns pid and every process below it.
+func descendants(pid int, children map[int][]int) []int {
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree
+}
+
+// FormatUptime renders seconds as e.g. "3d4h", "2h5m" or "40s".
+func FormatUptime(seconds int64) string {
+	d := time.Duration(seconds) * time.Second
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd%dh", d/(24*time.Hour), d%(24*time.Hour)/time.Hour)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%dm", d/time.Hour, d%time.Hour/time.Minute)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%ds", d/time.Minute, d%time.Minute/time.Second)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
+}
+
+// FormatBytes renders a byte count as e.g. "120.5 MB".
+func FormatBytes(b uint64) string {
+	return formatBytes(int64(b))
+}
@@ -0,0 +1,99 @@
+//go:build linux
+
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of CPU and start times in /proc; it is
+// 100 on every Linux architecture Go supports.
+const clockTicks = 100
+
+// readProcTable reads every process from /proc.
+func readProcTable() (map[int]procStat, error) {
+	boot, err := bootTime()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	procs := make(map[int]procStat, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if p, err := readProcStat(pid, boot); err == nil {
+			procs[pid] = p
+		}
+	}
+	return procs, nil
+}
+
+// readProcStat parses /proc/<pid>/stat.
+func readProcStat(pid int, boot time.Time) (procStat, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+	// The command name is parenthesized and may contain spaces
+	i := strings.LastIndexByte(string(data), ')')
+	if i < 0 {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	// fields[0] is field 3 (state) in proc(5)
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 22 {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	field := func(n int) uint64 {
+		v, _ := strconv.ParseUint(fields[n-3], 10, 64)
+		return v
+	}
+	return procStat{
+		ppid:    int(field(4)),
+		cpu:     time.Duration(field(14)+field(15)) * time.Second / clockTicks,
+		threads: int(field(20)),
+		start:   boot.Add(time.Duration(field(22)) * time.Second / clockTicks),
+		rss:     field(24) * uint64(os.Getpagesize()),
+	}, nil
+}
+
+// countFDs returns the number of open file descriptors of a process.
+func countFDs(pid int) int {
+	entries, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(pid), "fd"))
+	if err != nil {
+		return 0
+	}
+	return len(entries)
+}
+
+func bootTime() (time.Time, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			sec, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				break
+			}
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("boot time not found in /proc/stat")
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package services
+
+import "errors"
+
+// Usage sampling reads /proc and is only available on Linux.
+func readProcTable() (map[int]procStat, error) {
+	return nil, errors.New("usage sampling is only supported on Linux")
+}
+
+func countFDs(pid int) int {
+	return 0
+}
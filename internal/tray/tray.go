@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/getlantern/systray"
 	"github.com/pink-tools/pink-otel"
+	"github.com/pink-tools/pink-orchestrator/internal/config"
 	"github.com/pink-tools/pink-orchestrator/internal/registry"
 	"github.com/pink-tools/pink-orchestrator/internal/services"
 )
@@ -16,8 +18,11 @@ import (
 type serviceMenu struct {
 	name       string
 	isDaemon   bool
+	removed    bool
+	added      bool // by a registry change, under New Services
 	menuItem   *systray.MenuItem
 	mStatus    *systray.MenuItem
+	mUsage     *systray.MenuItem
 	mError     *systray.MenuItem
 	mUpdate    *systray.MenuItem
 	mInstall   *systray.MenuItem
@@ -30,7 +35,11 @@ type serviceMenu struct {
 }
 
 type Tray struct {
+	mu           sync.Mutex
 	serviceMenus []*serviceMenu
+	mRegistryErr *systray.MenuItem
+	mRegistryOld *systray.MenuItem
+	mNewServices *systray.MenuItem
 }
 
 func New() *Tray {
@@ -41,6 +50,11 @@ func (t *Tray) Run() {
 	systray.Run(t.onReady, t.onExit)
 }
 
+// Quit shuts the orchestrator down as the Quit menu item does.
+func (t *Tray) Quit() {
+	systray.Quit()
+}
+
 func (t *Tray) onReady() {
 	systray.SetIcon(iconData)
 	systray.SetTitle("")
@@ -54,10 +68,16 @@ func (t *Tray) onReady() {
 	}()
 
 	services.SetStatusCallback(t.updateMenus)
+	registry.SetChangeCallback(t.onRegistryChange)
 
 	t.buildMenu()
+	services.AdoptOrphans()
 	services.RestoreState()
 	t.updateMenus()
+
+	registry.Watch(config.RegistryInterval())
+	services.WatchUsage(services.UsageInterval)
+	services.WatchReconcile(config.ReconcileInterval())
 }
 
 func (t *Tray) onExit() {
@@ -69,22 +89,36 @@ func (t *Tray) onExit() {
 }
 
 func (t *Tray) buildMenu() {
+	t.mRegistryErr = systray.AddMenuItem("Failed to load registry", "")
+	t.mRegistryErr.Disable()
+	t.mRegistryErr.Hide()
+
+	// Shown while the published registry needs a newer orchestrator; click to update
+	t.mRegistryOld = systray.AddMenuItem("⚠ Orchestrator update required for this registry", "")
+	t.mRegistryOld.Hide()
+	go func() {
+		for range t.mRegistryOld.ClickedCh {
+			go t.updateOrchestrator()
+		}
+	}()
+
 	svcs, err := registry.ListServices()
 	if err != nil {
-		mError := systray.AddMenuItem("Failed to load registry", "")
-		mError.Disable()
-		systray.AddSeparator()
-		mQuit := systray.AddMenuItem("Quit", "")
-		go func() {
-			<-mQuit.ClickedCh
-			systray.Quit()
-		}()
-		return
+		t.mRegistryErr.Show()
+	}
+
+	// Services that don't ship for this platform are not shown
+	supported := svcs[:0]
+	for _, svc := range svcs {
+		if svc.Supports(config.Platform()) {
+			supported = append(supported, svc)
+		}
 	}
+	svcs = supported
 
 	for _, svc := range svcs {
 		if svc.Type == "daemon" {
-			sm := t.addServiceMenu(svc.Name)
+			sm := t.addServiceMenu(svc.Name, nil)
 			t.serviceMenus = append(t.serviceMenus, sm)
 		}
 	}
@@ -93,11 +127,15 @@ func (t *Tray) buildMenu() {
 
 	for _, svc := range svcs {
 		if svc.Type != "daemon" {
-			sm := t.addServiceMenu(svc.Name)
+			sm := t.addServiceMenu(svc.Name, nil)
 			t.serviceMenus = append(t.serviceMenus, sm)
 		}
 	}
 
+	// Holds services a registry change adds while running
+	t.mNewServices = systray.AddMenuItem("New Services", "Added to the registry since the orchestrator started")
+	t.mNewServices.Hide()
+
 	systray.AddSeparator()
 
 	mStartAll := systray.AddMenuItem("Start All", "")
@@ -117,6 +155,24 @@ func (t *Tray) buildMenu() {
 
 	systray.AddSeparator()
 
+	mDetach := systray.AddMenuItemCheckbox("Keep Services Running on Quit", "Services started from now on survive quitting or updating the orchestrator", services.Detached())
+	go func() {
+		for range mDetach.ClickedCh {
+			on := !mDetach.Checked()
+			if err := services.SetDetached(on); err != nil {
+				otel.Error(context.Background(), "failed to save detach mode", otel.Attr{"error", err.Error()})
+				continue
+			}
+			if on {
+				mDetach.Check()
+			} else {
+				mDetach.Uncheck()
+			}
+		}
+	}()
+
+	systray.AddSeparator()
+
 	mUpdateAll := systray.AddMenuItem("Update All Services", "")
 	mUpdateOrch := systray.AddMenuItem("Update Orchestrator", "")
 
@@ -139,17 +195,94 @@ func (t *Tray) buildMenu() {
 	}()
 }
 
-func (t *Tray) updateMenus() {
+// menus returns the service menus that are still in the registry.
+func (t *Tray) menus() []*serviceMenu {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var menus []*serviceMenu
 	for _, sm := range t.serviceMenus {
+		if !sm.removed {
+			menus = append(menus, sm)
+		}
+	}
+	return menus
+}
+
+func (t *Tray) updateMenus() {
+	if registry.Warning() != "" {
+		t.mRegistryOld.Show()
+	} else {
+		t.mRegistryOld.Hide()
+	}
+
+	for _, sm := range t.menus() {
 		t.updateServiceMenu(sm)
 	}
 }
 
+// onRegistryChange syncs service menus with a refreshed registry.
+// systray can neither insert nor remove items, so services that disappear
+// are hidden and services that appear go under New Services.
+func (t *Tray) onRegistryChange() {
+	otel.Info(context.Background(), "registry changed")
+	otel.SetServiceNameWidth(registry.MaxServiceNameLen())
+
+	svcs, err := registry.ListServices()
+	if err != nil {
+		t.mRegistryErr.Show()
+		return
+	}
+	t.mRegistryErr.Hide()
+
+	present := make(map[string]bool)
+	t.mu.Lock()
+	known := make(map[string]*serviceMenu)
+	for _, sm := range t.serviceMenus {
+		known[sm.name] = sm
+	}
+	for _, svc := range svcs {
+		if !svc.Supports(config.Platform()) {
+			continue
+		}
+		present[svc.Name] = true
+		if sm, ok := known[svc.Name]; ok {
+			sm.isDaemon = svc.Type == "daemon"
+			sm.removed = false
+			sm.menuItem.Show()
+			continue
+		}
+		sm := t.addServiceMenu(svc.Name, t.mNewServices)
+		sm.added = true
+		t.serviceMenus = append(t.serviceMenus, sm)
+	}
+	added := false
+	for _, sm := range t.serviceMenus {
+		if !present[sm.name] {
+			sm.removed = true
+			sm.menuItem.Hide()
+		}
+		added = added || (sm.added && !sm.removed)
+	}
+	t.mu.Unlock()
+
+	if added {
+		t.mNewServices.Show()
+	} else {
+		t.mNewServices.Hide()
+	}
+
+	t.updateMenus()
+}
+
 func (t *Tray) updateServiceMenu(sm *serviceMenu) {
 	status := services.GetStatus(sm.name)
 	installing := services.IsInstalling(sm.name)
 
 	hasError := services.GetLastError(sm.name) != ""
+	notReady := false
+	if p, ok := status.Probes[services.ProbeReadiness]; ok {
+		notReady = !p.Passing
+	}
 
 	var title string
 	switch {
@@ -163,6 +296,8 @@ func (t *Tray) updateServiceMenu(sm *serviceMenu) {
 		title = fmt.Sprintf("✓ %s", sm.name)
 	case status.Status == services.StatusStopped:
 		title = fmt.Sprintf("○ %s", sm.name)
+	case status.Status == services.StatusRunning && notReady:
+		title = fmt.Sprintf("◐ %s", sm.name)
 	case status.Status == services.StatusRunning:
 		title = fmt.Sprintf("● %s", sm.name)
 	default:
@@ -176,6 +311,13 @@ func (t *Tray) updateServiceMenu(sm *serviceMenu) {
 	}
 	sm.mStatus.SetTitle(fmt.Sprintf("Status: %s", truncate(lastStatus, 50)))
 
+	if u := services.CurrentUsage(sm.name); u != nil && status.Status == services.StatusRunning {
+		sm.mUsage.SetTitle(fmt.Sprintf("Usage: %s", u))
+		sm.mUsage.Show()
+	} else {
+		sm.mUsage.Hide()
+	}
+
 	lastError := services.GetLastError(sm.name)
 	if lastError != "" {
 		sm.mError.SetTitle(fmt.Sprintf("Error: %s", truncate(lastError, 50)))
@@ -231,10 +373,16 @@ func (t *Tray) updateServiceMenu(sm *serviceMenu) {
 	}
 }
 
-func (t *Tray) addServiceMenu(name string) *serviceMenu {
+// addServiceMenu adds a service's menu at the bottom of the tray menu, or
+// of parent when set.
+func (t *Tray) addServiceMenu(name string, parent *systray.MenuItem) *serviceMenu {
 	sm := &serviceMenu{name: name, isDaemon: registry.IsDaemon(name)}
 
-	sm.menuItem = systray.AddMenuItem(name, "")
+	if parent != nil {
+		sm.menuItem = parent.AddSubMenuItem(name, "")
+	} else {
+		sm.menuItem = systray.AddMenuItem(name, "")
+	}
 
 	sm.mInstall = sm.menuItem.AddSubMenuItem("Install", "")
 	sm.mCheck = sm.menuItem.AddSubMenuItem("Check", "")
@@ -250,6 +398,9 @@ func (t *Tray) addServiceMenu(name string) *serviceMenu {
 	sm.menuItem.AddSubMenuItem("───────────", "").Disable()
 	sm.mStatus = sm.menuItem.AddSubMenuItem("Status: -", "")
 	sm.mStatus.Disable()
+	sm.mUsage = sm.menuItem.AddSubMenuItem("Usage: -", "")
+	sm.mUsage.Disable()
+	sm.mUsage.Hide()
 	sm.mError = sm.menuItem.AddSubMenuItem("Error: -", "")
 	sm.mError.Disable()
 
@@ -336,7 +487,7 @@ func truncate(s string, max int) string {
 func (t *Tray) startAllServices() {
 	otel.Info(context.Background(), "starting all services")
 
-	for _, sm := range t.serviceMenus {
+	for _, sm := range t.menus() {
 		if !sm.isDaemon {
 			continue
 		}
@@ -344,6 +495,9 @@ func (t *Tray) startAllServices() {
 		if status.Status == services.StatusNotInstalled || status.Status == services.StatusRunning {
 			continue
 		}
+		if services.Desired(sm.name) == services.DesiredDisabled {
+			continue
+		}
 		otel.Info(context.Background(), "starting", otel.Attr{"service", sm.name})
 		services.Start(sm.name)
 	}
@@ -353,7 +507,7 @@ func (t *Tray) startAllServices() {
 func (t *Tray) stopAllServices() {
 	otel.Info(context.Background(), "stopping all services")
 
-	for _, sm := range t.serviceMenus {
+	for _, sm := range t.menus() {
 		if !sm.isDaemon {
 			continue
 		}
@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/pink-tools/pink-otel"
 	"github.com/pink-tools/pink-orchestrator/internal/api"
@@ -17,7 +22,18 @@ import (
 
 var version = "dev"
 
+// replaceTimeout bounds the wait for a replaced instance to stop its
+// services and exit.
+const replaceTimeout = 2 * time.Minute
+
 func main() {
+	// --user may come anywhere on the command line, before or after
+	// --replace or a command. Inherited by the updater and relaunched instances
+	if i := slices.Index(os.Args, "--user"); i > 0 {
+		os.Setenv("ORCHESTRATOR_USER_MODE", "1")
+		os.Args = slices.Delete(os.Args, i, i+1)
+	}
+
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
 		case "--version", "-V":
@@ -42,13 +58,30 @@ func main() {
 				os.Exit(1)
 			}
 			os.Exit(0)
-		case "--service-update", "--service-restart", "--service-stop", "--service-start":
+		case "--service-install":
+			if err := runInstall(false, os.Args[2:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		case "--service-update", "--service-restart", "--service-stop", "--service-start",
+			"--service-enable", "--service-disable", "--service-unpin":
 			if len(os.Args) < 3 {
 				fmt.Printf("Usage: pink-orchestrator %s <service-name>\n", os.Args[1])
 				os.Exit(1)
 			}
+			if os.Args[1] == "--service-update" && slices.Contains(os.Args[2:], "--dry-run") {
+				if err := runInstall(true, os.Args[2:]); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				os.Exit(0)
+			}
 			cmd := os.Args[1][len("--service-"):]
 			serviceName := os.Args[2]
+			if cmd == "start" && len(os.Args) > 3 {
+				startWithEnv(serviceName, os.Args[3:])
+			}
 			msg, err := api.Send(cmd, serviceName)
 			if err != nil {
 				fmt.Printf("Error: %v\n", err)
@@ -56,16 +89,92 @@ func main() {
 			}
 			fmt.Println(msg)
 			os.Exit(0)
+		case "--service-pin":
+			if len(os.Args) < 3 {
+				fmt.Println("Usage: pink-orchestrator --service-pin <service-name> [version]")
+				os.Exit(1)
+			}
+			arg := os.Args[2]
+			if len(os.Args) > 3 {
+				arg += "@" + os.Args[3]
+			}
+			msg, err := api.Send("pin", arg)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(msg)
+			os.Exit(0)
+		case "--status":
+			name := ""
+			if len(os.Args) > 2 {
+				name = os.Args[2]
+			}
+			if err := printStatus(name); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		case "env":
+			if err := runEnvCommand(os.Args[2:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		case "secret":
+			if err := runSecretCommand(os.Args[2:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		case "apply":
+			if err := runApply(os.Args[2:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		case "export":
+			if err := runExport(os.Args[2:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		case "import":
+			if err := runImport(os.Args[2:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		case "history":
+			if err := runHistory(os.Args[2:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		case "events":
+			if err := runEvents(os.Args[2:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		case "top":
+			if err := runTop(os.Args[2:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
 		case "--update-all":
 			updateAllServices()
 			os.Exit(0)
 		}
 	}
 
-	// On Unix, require root privileges for service management
-	if runtime.GOOS != "windows" && os.Getuid() != 0 {
+	// On Unix, require root privileges for service management unless
+	// running in user mode
+	if runtime.GOOS != "windows" && os.Getuid() != 0 && !config.UserMode() {
 		home := os.Getenv("HOME")
-		cmd := exec.Command("sudo", "env", fmt.Sprintf("HOME=%s", home), os.Args[0])
+		args := append([]string{"env", fmt.Sprintf("HOME=%s", home), os.Args[0]}, os.Args[1:]...)
+		cmd := exec.Command("sudo", args...)
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -84,14 +193,24 @@ func main() {
 		os.Exit(1)
 	}
 
+	services.SetOrchestratorBinaryVersion(version)
+
 	if err := services.AcquireLock(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		if !slices.Contains(os.Args[1:], "--replace") {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			var lockErr *services.LockError
+			if errors.As(err, &lockErr) && lockErr.Running {
+				fmt.Fprintln(os.Stderr, "Run with --replace to shut it down and take over")
+			}
+			os.Exit(1)
+		}
+		if err := replaceInstance(err); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	}
 	defer services.ReleaseLock()
 
-	services.SetOrchestratorBinaryVersion(version)
-
 	otel.Info(context.Background(), "started "+version, otel.Attr{"port", config.Port()})
 
 	apiServer, err := api.NewServer()
@@ -102,25 +221,178 @@ func main() {
 	go apiServer.Start()
 
 	t := tray.New()
+	api.SetShutdownCallback(t.Quit)
 	t.Run()
 }
 
+// replaceInstance asks the running orchestrator that holds the lock to
+// shut down, then takes the lock over.
+func replaceInstance(lockErr error) error {
+	var owner *services.LockError
+	if !errors.As(lockErr, &owner) || !owner.Running {
+		return lockErr
+	}
+	fmt.Printf("Shutting down pink-orchestrator v%s (pid %d)...\n", owner.Owner.Version, owner.Owner.PID)
+	port := owner.Owner.Port
+	if port == 0 {
+		// Recorded by an older version
+		port = config.Port()
+	}
+	if _, err := api.SendTo(port, "shutdown", ""); err != nil {
+		return fmt.Errorf("failed to ask pid %d to shut down: %w", owner.Owner.PID, err)
+	}
+	if err := services.WaitForLock(replaceTimeout); err != nil {
+		return fmt.Errorf("pid %d did not shut down within %s: %w", owner.Owner.PID, replaceTimeout, err)
+	}
+	return nil
+}
+
 func printUsage() {
 	fmt.Printf(`pink-orchestrator v%s - System tray manager for pink-tools services
 
 Usage:
   pink-orchestrator                             Start in system tray
+  pink-orchestrator --user                      Start in system tray without root (user mode)
+  pink-orchestrator --replace                   Start, shutting down an instance that is already running
   pink-orchestrator --health                    Check health
   pink-orchestrator --version                   Show version
+  pink-orchestrator --status [name]             Show service status
   pink-orchestrator --update-all                Update all installed services
-  pink-orchestrator --service-update <name>     Update a service
+  pink-orchestrator --service-install <name> [version] [--dry-run]
+                                                Install a service, latest release unless a version is given
+  pink-orchestrator --service-update <name> [--dry-run]
+                                                Update a service
   pink-orchestrator --service-restart <name>    Restart a service
   pink-orchestrator --service-stop <name>       Stop a service
-  pink-orchestrator --service-start <name>      Start a service
+  pink-orchestrator --service-start <name> [KEY=VALUE...]
+                                                Start a service, optionally overriding env vars
+  pink-orchestrator --service-enable <name>     Allow a disabled service to start again
+  pink-orchestrator --service-disable <name>    Stop a service and keep it from starting
+  pink-orchestrator --service-pin <name> [version]
+                                                Hold a service at a version (default: installed)
+  pink-orchestrator --service-unpin <name>      Let updates reach a pinned service again
+  pink-orchestrator env <name> <command>        Manage a service .env (list, get, set, unset, edit, resolve)
+                                                Use "global" as name for variables shared by all services
+  pink-orchestrator secret <command>            Manage encrypted secrets (list, set, rm, rotate, unlock)
+  pink-orchestrator apply <profile.yaml> [--yes] [--dry-run]
+                                                Install, configure and start services as a profile declares
+  pink-orchestrator export <file.tar.gz> [--plain-secrets | --no-secrets]
+                                                Save state, pins, registry overlay and .env files to an archive
+  pink-orchestrator import <file.tar.gz>        Restore an archive and reinstall the recorded versions
+  pink-orchestrator history <name> [-n N] [--stderr]
+                                                Show recent starts and exits of a service
+  pink-orchestrator events [name] [-n N]        Show actions taken to keep services in their desired state
+  pink-orchestrator top [name] [--once]         Show CPU, memory, threads and FDs of running services (Linux)
 
 Environment:
-  ORCHESTRATOR_PORT    API port (default: %d)
-`, version, config.DefaultPort)
+  ORCHESTRATOR_PORT                API port (default: %d)
+  ORCHESTRATOR_REGISTRY_URL        Registry location (default: %s)
+  ORCHESTRATOR_REGISTRY_INTERVAL   Registry refresh interval (default: %s)
+  ORCHESTRATOR_RECONCILE_INTERVAL  How often desired service states are enforced, 0 to turn off (default: %s)
+  ORCHESTRATOR_SECRETS_PASSPHRASE  Passphrase protecting the secret store (optional)
+  ORCHESTRATOR_USER_MODE           Set to 1 to run without root, as --user does
+  ORCHESTRATOR_DETACH              Set to 1 to keep services running when the orchestrator quits
+`, version, config.DefaultPort, config.DefaultRegistryURL, config.DefaultRegistryInterval, config.DefaultReconcileInterval)
+}
+
+func startWithEnv(name string, assignments []string) {
+	req := api.StartRequest{Service: name, Env: make(map[string]string)}
+	for _, a := range assignments {
+		key, value, ok := strings.Cut(a, "=")
+		if !ok {
+			fmt.Printf("Error: expected KEY=VALUE, got %q\n", a)
+			os.Exit(1)
+		}
+		req.Env[key] = value
+	}
+	if err := api.Call("start-env", req, nil); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("started")
+	os.Exit(0)
+}
+
+func printStatus(name string) error {
+	msg, err := api.Send("status", name)
+	if err != nil {
+		return err
+	}
+
+	var report services.Report
+	if err := json.Unmarshal([]byte(msg), &report); err != nil {
+		return fmt.Errorf("invalid status response: %w", err)
+	}
+
+	fmt.Printf("pink-orchestrator v%s (registry v%d)\n", report.Version, report.RegistryVersion)
+	if report.Warning != "" {
+		fmt.Printf("⚠ %s\n", report.Warning)
+	}
+
+	for _, svc := range report.Services {
+		line := fmt.Sprintf("  %-20s %-8s %s", svc.Name, svc.Type, svc.Status)
+		if svc.Adopted {
+			line += fmt.Sprintf(" (pid %d, adopted)", svc.PID)
+		} else if svc.PID != 0 {
+			line += fmt.Sprintf(" (pid %d)", svc.PID)
+		}
+		fmt.Println(line)
+		if svc.Command != "" {
+			fmt.Printf("      $ %s\n", svc.Command)
+			if svc.User != "" {
+				fmt.Printf("      in %s as %s\n", svc.WorkDir, svc.User)
+			} else {
+				fmt.Printf("      in %s\n", svc.WorkDir)
+			}
+		}
+		if svc.Usage != nil {
+			fmt.Printf("      %s\n", svc.Usage)
+		}
+		for _, kind := range []string{services.ProbeReadiness, services.ProbeLiveness} {
+			p, ok := svc.Probes[kind]
+			if !ok {
+				continue
+			}
+			switch {
+			case p.Passing && p.Failures == 0:
+				fmt.Printf("      %s: ok\n", kind)
+			case p.Passing:
+				fmt.Printf("      %s: ok, %d failed since last success: %s\n", kind, p.Failures, p.LastError)
+			default:
+				fmt.Printf("      %s: failing (%d): %s\n", kind, p.Failures, p.LastError)
+			}
+		}
+		if rec := svc.Record; rec != nil {
+			fmt.Printf("      %s\n", formatRecord(rec))
+		}
+		if run := svc.LastExit; run != nil && svc.Status != services.StatusRunning {
+			fmt.Printf("      last run: %s (%s) at %s after %s\n", run.Outcome, exitStatus(*run),
+				run.Exited.Local().Format("2006-01-02 15:04:05"), formatDuration(run.Duration))
+		}
+		if svc.LastError != "" {
+			fmt.Printf("      error: %s\n", svc.LastError)
+		}
+	}
+	return nil
+}
+
+// formatRecord summarises the persisted state of a service on one line.
+func formatRecord(rec *services.ServiceRecord) string {
+	parts := []string{"desired " + rec.Desired}
+	if rec.Desired == "" {
+		parts[0] = "desired " + services.DesiredStopped
+	}
+	if rec.Version != "" {
+		parts = append(parts, fmt.Sprintf("installed %s on %s", rec.Version, rec.InstalledAt.Local().Format("2006-01-02")))
+	}
+	if rec.Pin != "" {
+		parts = append(parts, "pinned at "+rec.Pin)
+	}
+	if rec.LatestVersion != "" {
+		parts = append(parts, fmt.Sprintf("latest %s (checked %s)", rec.LatestVersion, rec.LastUpdateCheck.Local().Format("2006-01-02 15:04")))
+	}
+	parts = append(parts, fmt.Sprintf("%d starts, %d crashes, %d restarts", rec.Starts, rec.Crashes, rec.Restarts))
+	return strings.Join(parts, ", ")
 }
 
 func updateAllServices() {
@@ -134,6 +406,9 @@ func updateAllServices() {
 
 	var updated, failed, skipped int
 	for _, svc := range svcs {
+		if !svc.Supports(config.Platform()) {
+			continue
+		}
 		if !services.IsInstalled(svc.Name) {
 			fmt.Printf("⊘ %s (not installed)\n", svc.Name)
 			skipped++
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pink-tools/pink-orchestrator/internal/api"
+	"golang.org/x/term"
+)
+
+func printSecretUsage() {
+	fmt.Println(`Usage: pink-orchestrator secret <command>
+
+Commands:
+  list                       Show stored secret names
+  set <name>                 Store a secret read from the terminal or stdin
+  rm <name>                  Delete a secret
+  rotate [--passphrase]      Re-encrypt under a new key, optionally changing the passphrase
+  unlock                     Give a running orchestrator the store passphrase
+
+Reference a secret from a .env file as KEY=secret://<name>.`)
+}
+
+func runSecretCommand(args []string) error {
+	if len(args) == 0 {
+		printSecretUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		var resp api.SecretResponse
+		if err := api.Call("secret", api.SecretRequest{Action: "list"}, &resp); err != nil {
+			return err
+		}
+		for _, name := range resp.Names {
+			fmt.Println(name)
+		}
+		return nil
+
+	case "set":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: secret set <name>")
+		}
+		value, err := readSecret(fmt.Sprintf("Value for %s: ", args[1]))
+		if err != nil {
+			return err
+		}
+		if err := api.Call("secret", api.SecretRequest{Action: "set", Name: args[1], Value: value}, nil); err != nil {
+			return err
+		}
+		fmt.Printf("Saved. Reference it as secret://%s\n", args[1])
+		return nil
+
+	case "rm":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: secret rm <name>")
+		}
+		if err := api.Call("secret", api.SecretRequest{Action: "delete", Name: args[1]}, nil); err != nil {
+			return err
+		}
+		fmt.Println("Deleted")
+		return nil
+
+	case "rotate":
+		req := api.SecretRequest{Action: "rotate"}
+		if len(args) > 1 && args[1] == "--passphrase" {
+			p, err := readSecret("New passphrase (empty for none): ")
+			if err != nil {
+				return err
+			}
+			req.Passphrase = &p
+		}
+		if err := api.Call("secret", req, nil); err != nil {
+			return err
+		}
+		fmt.Println("Rotated. Update ORCHESTRATOR_SECRETS_PASSPHRASE if the passphrase changed.")
+		return nil
+
+	case "unlock":
+		p, err := readSecret("Passphrase: ")
+		if err != nil {
+			return err
+		}
+		if err := api.Call("secret", api.SecretRequest{Action: "unlock", Passphrase: &p}, nil); err != nil {
+			return err
+		}
+		fmt.Println("Unlocked")
+		return nil
+
+	default:
+		printSecretUsage()
+		os.Exit(1)
+	}
+	return nil
+}
+
+// readSecret prompts without echo on a terminal, or reads stdin when piped.
+func readSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		value, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(value), err
+	}
+
+	value, err := io.ReadAll(bufio.NewReader(os.Stdin))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(value), "\r\n"), nil
+}
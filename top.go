@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pink-tools/pink-orchestrator/internal/api"
+	"github.com/pink-tools/pink-orchestrator/internal/services"
+)
+
+// sparkBlocks draw a usage history as a one-line chart.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// runTop prints resource usage of running services, refreshing until
+// interrupted unless --once is given. With a service name it also charts
+// the recent CPU and memory history.
+func runTop(args []string) error {
+	once := false
+	name := ""
+	for _, arg := range args {
+		if arg == "--once" {
+			once = true
+		} else {
+			name = arg
+		}
+	}
+
+	for {
+		msg, err := api.Send("status", name)
+		if err != nil {
+			return err
+		}
+		var report services.Report
+		if err := json.Unmarshal([]byte(msg), &report); err != nil {
+			return fmt.Errorf("invalid status response: %w", err)
+		}
+
+		if !once {
+			fmt.Print("\033[H\033[2J")
+		}
+		printTop(report)
+		if once {
+			return nil
+		}
+		time.Sleep(services.UsageInterval)
+	}
+}
+
+func printTop(report services.Report) {
+	fmt.Printf("%-20s %8s %7s %10s %8s %6s %6s %8s\n",
+		"NAME", "PID", "CPU%", "RSS", "THREADS", "FDS", "CHILD", "UPTIME")
+
+	for _, svc := range report.Services {
+		if svc.Status != services.StatusRunning {
+			continue
+		}
+		u := svc.Usage
+		if u == nil {
+			fmt.Printf("%-20s %8d %7s %10s %8s %6s %6s %8s\n", svc.Name, svc.PID, "-", "-", "-", "-", "-", "-")
+			continue
+		}
+		fmt.Printf("%-20s %8d %7.1f %10s %8d %6d %6d %8s\n", svc.Name, svc.PID,
+			u.CPU, services.FormatBytes(u.RSS), u.Threads, u.FDs, u.Children, services.FormatUptime(u.Uptime))
+
+		if len(svc.History) > 1 {
+			cpu := make([]float64, len(svc.History))
+			rss := make([]float64, len(svc.History))
+			for i, h := range svc.History {
+				cpu[i], rss[i] = h.CPU, float64(h.RSS)
+			}
+			fmt.Printf("\n  cpu %s\n  rss %s\n", sparkline(cpu), sparkline(rss))
+		}
+	}
+}
+
+func sparkline(values []float64) string {
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > 0 {
+			i = int(v / max * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}